@@ -1,25 +1,180 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/aggregate"
+	"github.com/sagacious-labs/k8trics/pkg/apis/grpcapi"
 	"github.com/sagacious-labs/k8trics/pkg/apis/rest"
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/certs"
+	"github.com/sagacious-labs/k8trics/pkg/controller"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/history"
 	"github.com/sagacious-labs/k8trics/pkg/k8s"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
 	"github.com/sagacious-labs/k8trics/pkg/store"
 	"github.com/sagacious-labs/k8trics/pkg/tracker"
 	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sagacious-labs/k8trics/pkg/workload"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
 	store := store.New()
 	utils.SetupLogger()
 
+	tlsStop := make(chan struct{})
+	tlsReload := utils.GetEnvDuration("K8TRICS_TLS_RELOAD_INTERVAL", 30*time.Second)
+
+	daemonTLS, err := certs.ClientConfigFromEnv()
+	if err != nil {
+		logrus.Fatal("invalid daemon TLS configuration: ", err)
+	}
+
+	var daemonCerts *certs.Client
+	if !daemonTLS.Files.Empty() {
+		reloader, err := certs.NewReloader(daemonTLS.Files, tlsReload)
+		if err != nil {
+			logrus.Fatal("failed to load the daemon TLS files: ", err)
+		}
+
+		reloader.Start(tlsStop)
+		daemonCerts = certs.NewClient(daemonTLS, reloader)
+	}
+	pool := rpc.NewPool(daemonCerts)
+
+	serverTLS, err := certs.ServerConfigFromEnv()
+	if err != nil {
+		logrus.Fatal("invalid TLS configuration: ", err)
+	}
+
+	// Both servers share the reloaded files, gRPC requires HTTP/2
+	var restTLS, grpcTLS *tls.Config
+	if !serverTLS.Files.Empty() {
+		reloader, err := certs.NewReloader(serverTLS.Files, tlsReload)
+		if err != nil {
+			logrus.Fatal("failed to load the TLS files: ", err)
+		}
+
+		reloader.Start(tlsStop)
+		restTLS = serverTLS.TLSConfig(reloader)
+		grpcTLS = serverTLS.TLSConfig(reloader, "h2")
+	}
+
+	discoveryCfg := discovery.NewConfig()
+	discoveryCfg.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
 	khandler, err := k8s.New(utils.GetEnv("KUBECONFIG", ""))
 	if err != nil {
 		panic(err)
 	}
 
-	tracker.
-		New(khandler, store).
-		Start()
+	discovery, err := discovery.New(discoveryCfg, store, khandler.Informers())
+	if err != nil {
+		logrus.Fatal("invalid discovery configuration: ", err)
+	}
+
+	resolver := workload.New(khandler.Informers())
+	enricher := enrich.New(store, resolver, enrich.LabelsFromEnv())
+	tracker := tracker.New(khandler, store, pool)
+	exporter := exporter.New(store, pool, discovery, enricher)
+	fanout := fanout.New(discovery, pool, utils.GetEnvInt("K8TRICS_FANOUT_CONCURRENCY", 16))
+	verifier, err := release.New(release.ConfigFromEnv())
+	if err != nil {
+		logrus.Fatal("invalid release verification configuration: ", err)
+	}
+	controller := controller.New(khandler, tracker, discovery, fanout, exporter, verifier)
+
+	auth, err := auth.FromEnv(khandler.ClientSet())
+	if err != nil {
+		logrus.Fatal("invalid auth configuration: ", err)
+	}
+
+	auditor, err := audit.FromEnv(khandler.ClientSet())
+	if err != nil {
+		logrus.Fatal("failed to set up the audit log: ", err)
+	}
+
+	modules := registry.New(registry.BackendFromEnv(khandler.ClientSet()))
+	if err := modules.Load(ctx); err != nil {
+		logrus.Fatal("failed to load the module registry: ", err)
+	}
+	registry.NewReplayer(ctx, modules, tracker, discovery, fanout)
+
+	tracker.Start()
+
+	logrus.Infoln("Waiting for the informer caches to sync")
+	if !tracker.WaitForSync() {
+		logrus.Fatal("failed to sync the informer caches")
+	}
+
+	exporterStop := make(chan struct{})
+	aggregator := aggregate.NewEngine(aggregate.WindowFromEnv())
+	history := history.New(history.ConfigFromEnv())
+	exporter.OnSample(func(module string, item *rpc.WatchDataResponse) {
+		aggregator.Record(module, item.Data)
+		history.Record(module, item)
+	})
+	aggregator.Start(exporterStop)
+	history.Start(exporterStop)
+	exporter.Start(exporterStop)
+
+	for _, entry := range modules.List() {
+		exporter.Subscribe(entry.Module.GetCore().GetName())
+	}
+
+	shutdownTimeout := utils.GetEnvDuration("K8TRICS_SHUTDOWN_TIMEOUT", 15*time.Second)
+
+	// Either of the servers failing brings the other one down as well
+	ctx, stopServers := context.WithCancel(ctx)
+	defer stopServers()
+
+	controllerDone := make(chan struct{})
+	go func() {
+		defer close(controllerDone)
+
+		if err := controller.Run(ctx); err != nil {
+			logrus.Error("module controller stopped: ", err)
+		}
+	}()
+
+	grpcDone := make(chan struct{})
+	go func() {
+		defer close(grpcDone)
+		defer stopServers()
+
+		if err := grpcapi.Run(ctx, store, discovery, fanout, exporter, modules, enricher, verifier, auth, auditor, grpcTLS, shutdownTimeout); err != nil {
+			logrus.Error("gRPC server stopped: ", err)
+		}
+	}()
+
+	if err := rest.Run(ctx, store, pool, discovery, fanout, exporter, tracker, modules, enricher, aggregator, history, auth, auditor, verifier, restTLS, shutdownTimeout); err != nil {
+		logrus.Error("REST server stopped: ", err)
+	}
+	stopServers()
+	<-grpcDone
+	<-controllerDone
 
-	rest.Run(store)
+	close(exporterStop)
+	close(tlsStop)
+	tracker.Stop()
+	khandler.Close()
+	pool.CloseAll()
+	auditor.Close()
 }
@@ -0,0 +1,151 @@
+package aggregate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MinWindow and MaxWindow bound the length of the windows
+	MinWindow = time.Second
+	MaxWindow = time.Hour
+)
+
+// Engine continuously rolls the data of the modules up by every dimension
+// over tumbling windows and keeps the snapshot of the last complete window
+//
+// The engine is fed with the samples of the exporter, hence only the
+// modules to which the exporter is subscribed are aggregated
+type Engine struct {
+	window time.Duration
+
+	// windows and snapshots are keyed by module and then by dimension
+	windows   map[string]map[GroupBy]*Window
+	snapshots map[string]map[GroupBy]Snapshot
+
+	lock sync.Mutex
+}
+
+// WindowFromEnv reads the length of the windows of the engine from
+// K8TRICS_AGGREGATE_WINDOW, a length out of bounds is clamped
+func WindowFromEnv() time.Duration {
+	window := utils.GetEnvDuration("K8TRICS_AGGREGATE_WINDOW", 30*time.Second)
+	if clamped := ClampWindow(window); clamped != window {
+		logrus.Warnf("aggregate window %s is out of bounds, using %s", window, clamped)
+		return clamped
+	}
+
+	return window
+}
+
+// ClampWindow takes in the length of a window and returns it within
+// MinWindow and MaxWindow
+func ClampWindow(window time.Duration) time.Duration {
+	if window < MinWindow {
+		return MinWindow
+	}
+	if window > MaxWindow {
+		return MaxWindow
+	}
+
+	return window
+}
+
+// NewEngine takes in the length of the windows and returns a new instance
+// of Engine, the length is clamped within MinWindow and MaxWindow
+func NewEngine(window time.Duration) *Engine {
+	return &Engine{
+		window:    ClampWindow(window),
+		windows:   make(map[string]map[GroupBy]*Window),
+		snapshots: make(map[string]map[GroupBy]Snapshot),
+	}
+}
+
+// Window returns the length of the windows of the engine
+func (e *Engine) Window() time.Duration {
+	return e.window
+}
+
+// Record takes in the name of a module and the enriched data of a sample
+// and adds the sample to the current windows of the module
+func (e *Engine) Record(module string, data map[string]interface{}) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	windows, ok := e.windows[module]
+	if !ok {
+		windows = make(map[GroupBy]*Window, len(GroupBys))
+		for _, groupBy := range GroupBys {
+			windows[groupBy] = NewWindow(groupBy, nil, time.Now())
+		}
+
+		e.windows[module] = windows
+	}
+
+	for _, window := range windows {
+		window.Add(data)
+	}
+}
+
+// Start starts closing the windows of the engine, it runs until the stop
+// channel is closed
+func (e *Engine) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(e.window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				e.flush(now)
+			}
+		}
+	}()
+}
+
+// Snapshot takes in the name of a module and a dimension and returns the
+// snapshot of the last complete window of the module
+func (e *Engine) Snapshot(module string, groupBy GroupBy) (Snapshot, bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	snapshot, ok := e.snapshots[module][groupBy]
+	return snapshot, ok
+}
+
+// flush closes the current windows, the modules which did not receive any
+// sample during the window are forgotten
+func (e *Engine) flush(now time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for module, windows := range e.windows {
+		if empty(windows) {
+			delete(e.windows, module)
+			delete(e.snapshots, module)
+			continue
+		}
+
+		snapshots := make(map[GroupBy]Snapshot, len(windows))
+		for groupBy, window := range windows {
+			snapshots[groupBy] = window.Flush(now)
+		}
+
+		e.snapshots[module] = snapshots
+	}
+}
+
+func empty(windows map[GroupBy]*Window) bool {
+	for _, window := range windows {
+		if !window.Empty() {
+			return false
+		}
+	}
+
+	return true
+}
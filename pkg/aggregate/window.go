@@ -0,0 +1,305 @@
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+)
+
+// maxValues is the maximum number of values kept per field and group to
+// compute the percentiles, beyond it the values are reservoir sampled
+const maxValues = 4096
+
+// GroupBy is the dimension the data is rolled up by
+type GroupBy string
+
+const (
+	GroupByPod       GroupBy = "pod"
+	GroupByWorkload  GroupBy = "workload"
+	GroupByNamespace GroupBy = "namespace"
+	GroupByNode      GroupBy = "node"
+)
+
+// GroupBys are all of the supported dimensions
+var GroupBys = []GroupBy{GroupByPod, GroupByWorkload, GroupByNamespace, GroupByNode}
+
+// ParseGroupBy takes in the name of a dimension and returns the dimension
+func ParseGroupBy(name string) (GroupBy, error) {
+	for _, groupBy := range GroupBys {
+		if string(groupBy) == name {
+			return groupBy, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid group by %q", name)
+}
+
+// Stat is a statistic computed over the values of a field in a window
+type Stat string
+
+const (
+	StatCount Stat = "count"
+	StatSum   Stat = "sum"
+	StatAvg   Stat = "avg"
+	StatMin   Stat = "min"
+	StatMax   Stat = "max"
+	StatP50   Stat = "p50"
+	StatP95   Stat = "p95"
+	StatP99   Stat = "p99"
+)
+
+// Stats are all of the supported statistics
+var Stats = []Stat{StatCount, StatSum, StatAvg, StatMin, StatMax, StatP50, StatP95, StatP99}
+
+// ParseStats takes in a list of statistics, each of which may be a comma
+// separated list, and returns the statistics, an empty list means all of
+// the statistics
+func ParseStats(names []string) ([]Stat, error) {
+	stats := []Stat{}
+
+	for _, param := range names {
+		for _, name := range strings.Split(param, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+
+			stat, err := parseStat(name)
+			if err != nil {
+				return nil, err
+			}
+
+			stats = append(stats, stat)
+		}
+	}
+
+	if len(stats) == 0 {
+		return Stats, nil
+	}
+
+	return stats, nil
+}
+
+func parseStat(name string) (Stat, error) {
+	for _, stat := range Stats {
+		if string(stat) == name {
+			return stat, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid statistic %q", name)
+}
+
+// Snapshot is the outcome of a window
+type Snapshot struct {
+	GroupBy GroupBy   `json:"groupBy"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Groups  []Group   `json:"groups"`
+}
+
+// Group holds the statistics of every field of a group, keyed by field
+// and then by statistic
+type Group struct {
+	Key    string                      `json:"key"`
+	Fields map[string]map[Stat]float64 `json:"fields"`
+}
+
+// Select takes in a list of statistics and returns a copy of the snapshot
+// with only those statistics
+func (s Snapshot) Select(stats []Stat) Snapshot {
+	selected := s
+	selected.Groups = make([]Group, 0, len(s.Groups))
+
+	for _, group := range s.Groups {
+		fields := make(map[string]map[Stat]float64, len(group.Fields))
+		for field, values := range group.Fields {
+			fields[field] = make(map[Stat]float64, len(stats))
+			for _, stat := range stats {
+				if value, ok := values[stat]; ok {
+					fields[field][stat] = value
+				}
+			}
+		}
+
+		selected.Groups = append(selected.Groups, Group{Key: group.Key, Fields: fields})
+	}
+
+	return selected
+}
+
+// Window rolls the numeric fields of the data up by a dimension over a
+// tumbling window
+type Window struct {
+	groupBy GroupBy
+	fields  map[string]struct{}
+	start   time.Time
+
+	// series is keyed by group and then by field
+	series map[string]map[string]*series
+}
+
+// NewWindow takes in the dimension, the fields to aggregate, empty means
+// every numeric field, and the start of the window and returns a new
+// window
+func NewWindow(groupBy GroupBy, fields []string, start time.Time) *Window {
+	w := &Window{
+		groupBy: groupBy,
+		start:   start,
+		series:  make(map[string]map[string]*series),
+	}
+
+	if len(fields) > 0 {
+		w.fields = make(map[string]struct{}, len(fields))
+		for _, field := range fields {
+			w.fields[field] = struct{}{}
+		}
+	}
+
+	return w
+}
+
+// Add takes in the enriched data of a module and adds its numeric fields
+// to the group of the data, the data which cannot be grouped is skipped
+func (w *Window) Add(data map[string]interface{}) {
+	key, ok := groupKey(w.groupBy, data)
+	if !ok {
+		return
+	}
+
+	group, ok := w.series[key]
+	if !ok {
+		group = make(map[string]*series)
+		w.series[key] = group
+	}
+
+	for field, value := range enrich.NumericFields(data) {
+		if _, ok := w.fields[field]; w.fields != nil && !ok {
+			continue
+		}
+
+		s, ok := group[field]
+		if !ok {
+			s = &series{min: math.Inf(1), max: math.Inf(-1)}
+			group[field] = s
+		}
+
+		s.add(value)
+	}
+}
+
+// Empty returns true if nothing was added to the window
+func (w *Window) Empty() bool {
+	return len(w.series) == 0
+}
+
+// Flush takes in the end of the window, computes the snapshot of the
+// window and starts a new window at the end of the previous one
+func (w *Window) Flush(end time.Time) Snapshot {
+	snapshot := Snapshot{
+		GroupBy: w.groupBy,
+		Start:   w.start,
+		End:     end,
+		Groups:  make([]Group, 0, len(w.series)),
+	}
+
+	for key, fields := range w.series {
+		group := Group{Key: key, Fields: make(map[string]map[Stat]float64, len(fields))}
+		for field, s := range fields {
+			group.Fields[field] = s.stats()
+		}
+
+		snapshot.Groups = append(snapshot.Groups, group)
+	}
+
+	sort.Slice(snapshot.Groups, func(i, j int) bool {
+		return snapshot.Groups[i].Key < snapshot.Groups[j].Key
+	})
+
+	w.start = end
+	w.series = make(map[string]map[string]*series)
+
+	return snapshot
+}
+
+// groupKey takes in the enriched data of a module and returns the key of
+// its group
+func groupKey(groupBy GroupBy, data map[string]interface{}) (string, bool) {
+	namespace, _ := data["namespace"].(string)
+
+	switch groupBy {
+	case GroupByPod:
+		pod, ok := data["pod"].(string)
+		return namespace + "/" + pod, ok
+	case GroupByWorkload:
+		owner, _ := data["owner"].(map[string]interface{})
+		kind, _ := owner["kind"].(string)
+		name, ok := owner["name"].(string)
+		return namespace + "/" + kind + "/" + name, ok
+	case GroupByNamespace:
+		return namespace, namespace != ""
+	case GroupByNode:
+		node, ok := data["node"].(string)
+		return node, ok && node != ""
+	}
+
+	return "", false
+}
+
+// series holds the values of a field of a group
+type series struct {
+	count    int64
+	sum      float64
+	min, max float64
+	values   []float64
+}
+
+func (s *series) add(value float64) {
+	s.count++
+	s.sum += value
+	s.min = math.Min(s.min, value)
+	s.max = math.Max(s.max, value)
+
+	if len(s.values) < maxValues {
+		s.values = append(s.values, value)
+		return
+	}
+
+	if i := rand.Int63n(s.count); i < maxValues {
+		s.values[i] = value
+	}
+}
+
+func (s *series) stats() map[Stat]float64 {
+	sort.Float64s(s.values)
+
+	return map[Stat]float64{
+		StatCount: float64(s.count),
+		StatSum:   s.sum,
+		StatAvg:   s.sum / float64(s.count),
+		StatMin:   s.min,
+		StatMax:   s.max,
+		StatP50:   percentile(s.values, 0.50),
+		StatP95:   percentile(s.values, 0.95),
+		StatP99:   percentile(s.values, 0.99),
+	}
+}
+
+// percentile takes in sorted values and returns the nearest-rank
+// percentile of the values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
@@ -0,0 +1,133 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadataKey is the request metadata key carrying the
+// credentials, it mirrors the Authorization header of the REST API
+const authorizationMetadataKey = "authorization"
+
+// callCredentials takes in the context of a call and returns its credentials
+func callCredentials(ctx context.Context) auth.Credentials {
+	creds := auth.Credentials{}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationMetadataKey); len(values) > 0 {
+			creds.Authorization = values[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			creds.TLS = &info.State
+		}
+	}
+
+	return creds
+}
+
+// authenticate takes in the context of a call and returns the context
+// carrying the authenticated subject of the call
+func authenticate(ctx context.Context, a *auth.Auth) (context.Context, error) {
+	subject, err := a.Authenticate(ctx, callCredentials(ctx))
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			logrus.Warnf("failed to authenticate call: %s", err)
+		}
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return auth.NewContext(ctx, subject), nil
+}
+
+// unaryAuthInterceptor returns the interceptor authenticating the callers
+// of the unary methods
+func unaryAuthInterceptor(a *auth.Auth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// streamAuthInterceptor returns the interceptor authenticating the callers
+// of the streaming methods
+func streamAuthInterceptor(a *auth.Auth) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedStream is a server stream whose context carries the
+// authenticated subject
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorize takes in the audit record of a mutation and the labels of the
+// module and returns a PermissionDenied error if the subject of the call
+// is not allowed to perform the mutation, the denial is audited
+func (s *Server) authorize(record *audit.Record, labels map[string]string) error {
+	module := record.Core.GetName()
+
+	if err := s.auth.Authorize(record.Subject, record.Verb, module, labels); err != nil {
+		logrus.Infof("denied %s of module %s to %s", record.Verb, module, record.Subject.Name)
+		s.audit.Log(record.Deny(err))
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return nil
+}
+
+// auditRecord takes in the context of a call along with the verb, the
+// module and the node filter of a mutation and returns its audit record
+func (s *Server) auditRecord(ctx context.Context, verb string, module *base.Module, filter discovery.NodeFilter) *audit.Record {
+	sourceIP := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		sourceIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(sourceIP); err == nil {
+			sourceIP = host
+		}
+	}
+
+	return audit.NewRecord(verb, auth.FromContext(ctx), sourceIP, module, s.discovery.Select(filter))
+}
+
+// moduleLabels takes in a module and returns its labels, a module without
+// labels has an empty set of labels rather than unknown ones
+func moduleLabels(module *base.Module) map[string]string {
+	if labels := module.GetMetadata().GetLabels(); labels != nil {
+		return labels
+	}
+
+	return map[string]string{}
+}
@@ -0,0 +1,85 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Run starts the gRPC server and blocks until the given context is
+// cancelled, after which the server is shut down gracefully
+//
+// Every call is authenticated the same way as the REST API and the Apply
+// and Delete calls are authorized against the same rules
+//
+// The server serves TLS if the TLS configuration is not nil, otherwise it
+// serves plaintext
+//
+// The server is stopped forcefully, cancelling the in-flight streams, if
+// it fails to shut down within shutdownTimeout
+func Run(ctx context.Context, store *store.PodStore, discovery *discovery.Discovery, fanout *fanout.Fanout, exporter *exporter.Exporter, registry *registry.Registry, enricher *enrich.Enricher, verifier *release.Verifier, auth *auth.Auth, audit *audit.Logger, tlsConfig *tls.Config, shutdownTimeout time.Duration) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", utils.GetEnv("K8TRICS_GRPC_PORT", "9090")))
+	if err != nil {
+		return err
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryAuthInterceptor(auth)),
+		grpc.StreamInterceptor(streamAuthInterceptor(auth)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	api.RegisterHyperionAPIServiceServer(srv, NewServer(store, discovery, fanout, exporter, registry, enricher, verifier, auth, audit))
+
+	errCh := make(chan error, 1)
+	go func() {
+		logrus.Infof("Listening and serving gRPC on %s", lis.Addr())
+		if err := srv.Serve(lis); err != nil {
+			errCh <- err
+		}
+
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infoln("Shutting down the gRPC server")
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		srv.Stop()
+	}
+
+	return nil
+}
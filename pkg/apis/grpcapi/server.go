@@ -0,0 +1,383 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanin"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/rollout"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// nodeMetadataKey is the request metadata key carrying the names of the
+	// nodes to target, it mirrors the "node" query param of the REST API
+	nodeMetadataKey = "k8trics-node"
+
+	// nodeSelectorMetadataKey is the request metadata key carrying the label
+	// selector of the nodes to target, it mirrors the "nodeSelector" query
+	// param of the REST API
+	nodeSelectorMetadataKey = "k8trics-node-selector"
+
+	// succeededMetadataKey, failedMetadataKey and skippedMetadataKey are
+	// the trailer keys carrying the nodes on which a unary request
+	// succeeded, failed and was skipped
+	succeededMetadataKey = "k8trics-succeeded-nodes"
+	failedMetadataKey    = "k8trics-failed-nodes"
+	skippedMetadataKey   = "k8trics-skipped-nodes"
+)
+
+// Server implements the hyperion API on top of all of the hyperion daemons
+// in the cluster, every request is aggregated across the daemons the same
+// way as the REST API does
+type Server struct {
+	api.UnimplementedHyperionAPIServiceServer
+
+	store     *store.PodStore
+	discovery *discovery.Discovery
+	fanout    *fanout.Fanout
+	exporter  *exporter.Exporter
+	registry  *registry.Registry
+	enricher  *enrich.Enricher
+	verifier  *release.Verifier
+	auth      *auth.Auth
+	audit     *audit.Logger
+	streamCfg fanin.Config
+
+	rolloutPolicy rollout.Policy
+}
+
+// NewServer returns a new instance of the hyperion API server
+func NewServer(store *store.PodStore, discovery *discovery.Discovery, fanout *fanout.Fanout, exporter *exporter.Exporter, registry *registry.Registry, enricher *enrich.Enricher, verifier *release.Verifier, auth *auth.Auth, audit *audit.Logger) *Server {
+	return &Server{
+		store:     store,
+		discovery: discovery,
+		fanout:    fanout,
+		exporter:  exporter,
+		registry:  registry,
+		enricher:  enricher,
+		verifier:  verifier,
+		auth:      auth,
+		audit:     audit,
+		streamCfg: fanin.ConfigFromEnv(),
+
+		rolloutPolicy: rollout.PolicyFromEnv(),
+	}
+}
+
+// Apply verifies the releases of the module and forwards the apply
+// request to every targeted daemon
+func (s *Server) Apply(ctx context.Context, req *api.ApplyRequest) (*api.ApplyResponse, error) {
+	filter, err := nodeFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.GetModule().GetCore().GetName()
+	record := s.auditRecord(ctx, auth.VerbApply, req.GetModule(), filter)
+	if err := s.authorize(record, moduleLabels(req.GetModule())); err != nil {
+		return nil, err
+	}
+
+	// Replacing a module requires being allowed to apply the module as it
+	// is as well, otherwise relabelling would get around the rules
+	if entry, ok := s.registry.Get(name); ok {
+		if err := s.authorize(record, moduleLabels(entry.Module)); err != nil {
+			return nil, err
+		}
+	}
+
+	daemons := s.discovery.Select(filter)
+	if len(daemons) == 0 {
+		s.audit.Log(record.Reject(fanout.ErrNoDaemons))
+		return nil, toStatus(fanout.ErrNoDaemons)
+	}
+
+	if err := s.verifier.Verify(ctx, req.GetModule()); err != nil {
+		s.audit.Log(record.Reject(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	plan := rollout.New(s.discovery, req.GetModule(), daemons)
+	if plan.Empty() {
+		err := fmt.Errorf("module %s has no release for the architecture of any of the targeted nodes", name)
+		s.audit.Log(record.Reject(err))
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	res := s.fanout.RequestDaemons(plan.Targets, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionApply(ctx, req, conn)
+	})
+	plan.Report(res, s.rolloutPolicy)
+	s.audit.Log(record.Complete(res))
+	if err := finish(ctx, res); err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		s.exporter.Subscribe(name)
+
+		if err := s.registry.Put(ctx, req.GetModule(), filter, plan.Targets); err != nil {
+			logrus.Warnf("failed to record module %s in the registry: %s", name, err)
+		}
+	}
+
+	return &api.ApplyResponse{Msg: summary(res)}, nil
+}
+
+// Delete forwards the delete request to every targeted daemon
+func (s *Server) Delete(ctx context.Context, req *api.DeleteRequest) (*api.DeleteResponse, error) {
+	filter, err := nodeFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The labels of the module are only known if it is in the registry
+	module := &base.Module{Core: req.GetCore()}
+	var labels map[string]string
+	if entry, ok := s.registry.Get(req.GetCore().GetName()); ok {
+		module.Metadata = entry.Module.GetMetadata()
+		labels = moduleLabels(entry.Module)
+	}
+
+	record := s.auditRecord(ctx, auth.VerbDelete, module, filter)
+	if err := s.authorize(record, labels); err != nil {
+		return nil, err
+	}
+
+	daemons := s.discovery.Select(filter)
+	res := s.fanout.RequestDaemons(daemons, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionDelete(ctx, req, conn)
+	})
+	s.audit.Log(record.Complete(res))
+	if err := finish(ctx, res); err != nil {
+		return nil, err
+	}
+
+	forgotten, err := s.registry.Delete(ctx, req.GetCore().GetName(), filter, daemons)
+	if err != nil {
+		logrus.Warnf("failed to remove module %s from the registry: %s", req.GetCore().GetName(), err)
+	}
+
+	// The module is still running on the other nodes if only some of the
+	// nodes were targeted
+	if forgotten || filter.Empty() {
+		s.exporter.Unsubscribe(req.GetCore().GetName())
+	}
+
+	return &api.DeleteResponse{Msg: summary(res)}, nil
+}
+
+// Get forwards the get request to every targeted daemon and returns the
+// response of the first daemon which succeeds
+func (s *Server) Get(ctx context.Context, req *api.GetRequest) (*api.GetResponse, error) {
+	filter, err := nodeFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.fanout.Request(filter, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionGet(ctx, req, conn)
+	})
+	if err := finish(ctx, res); err != nil {
+		return nil, err
+	}
+
+	for _, result := range res.Results {
+		if resp, ok := result.Response.(*api.GetResponse); ok {
+			return resp, nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "module not found")
+}
+
+// List streams the modules of every targeted daemon
+func (s *Server) List(req *api.ListRequest, srv api.HyperionAPIService_ListServer) error {
+	return s.stream(srv.Context(), s.fanout.Stream, func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+		resp, err := rpc.HyperionList(ctx, req, conn)
+		if err != nil {
+			return err
+		}
+
+		for data := range resp {
+			if !emit(data) {
+				break
+			}
+		}
+
+		return nil
+	}, func(item interface{}) error {
+		return srv.Send(item.(*api.GetResponse))
+	})
+}
+
+// WatchData streams the data of the module from every targeted daemon, the
+// data is enriched with the pod info the same way as the REST API does
+func (s *Server) WatchData(req *api.WatchDataRequest, srv api.HyperionAPIService_WatchDataServer) error {
+	return s.stream(srv.Context(), s.fanout.Watch, func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+		ctx = context.WithValue(ctx, "enricher", s.enricher)
+		resp, streamErr, err := rpc.HyperionWatchData(ctx, req, conn)
+		if err != nil {
+			return err
+		}
+
+		for data := range resp {
+			fanout.Received(ctx)
+
+			if !emit(data) {
+				return nil
+			}
+		}
+
+		return streamErr()
+	}, func(item interface{}) error {
+		byt, err := json.Marshal(item.(*rpc.WatchDataResponse).Data)
+		if err != nil {
+			return err
+		}
+
+		return srv.Send(&api.WatchDataResponse{Data: byt})
+	})
+}
+
+// WatchLog streams the logs of the module from every targeted daemon
+func (s *Server) WatchLog(req *api.WatchLogRequest, srv api.HyperionAPIService_WatchLogServer) error {
+	return s.stream(srv.Context(), s.fanout.Watch, func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+		resp, streamErr, err := rpc.HyperionWatchLog(ctx, req, conn)
+		if err != nil {
+			return err
+		}
+
+		for data := range resp {
+			fanout.Received(ctx)
+
+			if !emit(data) {
+				return nil
+			}
+		}
+
+		return streamErr()
+	}, func(item interface{}) error {
+		return srv.Send(&api.WatchLogResponse{Data: []byte(item.(string))})
+	})
+}
+
+// stream opens the upstreams using the given fanout method and sends every
+// item of the merged stream to the client until the stream ends or the
+// client goes away
+//
+// The notifications about the stream itself, eg. reconnects, have no
+// place in the hyperion messages and are only logged
+func (s *Server) stream(
+	ctx context.Context,
+	open func(*fanin.Mux, discovery.NodeFilter, fanout.Upstream) error,
+	fn fanout.Upstream,
+	send func(item interface{}) error,
+) error {
+	filter, err := nodeFilter(ctx)
+	if err != nil {
+		return err
+	}
+
+	mux := fanin.New(ctx, s.streamCfg)
+	defer mux.Close()
+
+	if err := open(mux, filter, fn); err != nil {
+		return toStatus(err)
+	}
+
+	for item := range mux.Out() {
+		if ev, ok := item.(fanout.Event); ok {
+			logrus.Debugf("stream %s event: %v", ev.Name, ev.Data)
+			continue
+		}
+
+		if err := send(item); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// nodeFilter reads the node filter from the incoming request metadata
+func nodeFilter(ctx context.Context) (discovery.NodeFilter, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	selector := ""
+	if values := md.Get(nodeSelectorMetadataKey); len(values) > 0 {
+		selector = values[0]
+	}
+
+	filter, err := discovery.ParseNodeFilter(md.Get(nodeMetadataKey), selector)
+	if err != nil {
+		return filter, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return filter, nil
+}
+
+// finish takes in the result of a unary request, attaches the succeeded
+// and failed nodes to the trailer and returns an error if the request
+// failed on every daemon
+func finish(ctx context.Context, res *fanout.Result) error {
+	if err := grpc.SetTrailer(ctx, metadata.MD{
+		succeededMetadataKey: res.Succeeded,
+		failedMetadataKey:    res.Failed,
+		skippedMetadataKey:   res.Skipped,
+	}); err != nil {
+		logrus.Warn("failed to set trailer: ", err)
+	}
+
+	return toStatus(res.Err())
+}
+
+// toStatus takes in an error and converts it into a gRPC status error
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == fanout.ErrNoDaemons {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// summary returns a human readable summary of the result
+func summary(res *fanout.Result) string {
+	msg := fmt.Sprintf("succeeded on %d of %d daemons", len(res.Succeeded), len(res.Results))
+	if len(res.Failed) > 0 {
+		msg += fmt.Sprintf(", failed on nodes: %s", strings.Join(res.Failed, ", "))
+	}
+
+	if len(res.Skipped) > 0 {
+		msg += fmt.Sprintf(", skipped nodes: %s", strings.Join(res.Skipped, ", "))
+	}
+
+	return msg
+}
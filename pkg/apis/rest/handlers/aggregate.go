@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/aggregate"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+)
+
+// aggregateQuery reads the "groupBy", default "pod", and "stats" query
+// params and returns the dimension and the statistics of the request
+func aggregateQuery(c *gin.Context) (aggregate.GroupBy, []aggregate.Stat, error) {
+	groupBy, err := aggregate.ParseGroupBy(c.DefaultQuery("groupBy", string(aggregate.GroupByPod)))
+	if err != nil {
+		return "", nil, err
+	}
+
+	stats, err := aggregate.ParseStats(c.QueryArray("stats"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return groupBy, stats, nil
+}
+
+// WatchAggregate streams the data of the module rolled up over tumbling
+// windows as server sent events, one "aggregate" event per window
+//
+// The window is set by the "window" query param, eg. "10s", the dimension
+// and the statistics by the params described by aggregateQuery and the
+// data can be filtered with the params described by parseDataFilter, in
+// which case "fields" selects the fields to aggregate
+func (h *Handlers) WatchAggregate(c *gin.Context) {
+	groupBy, stats, err := aggregateQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	window := h.aggregator.Window()
+	if raw := c.Query("window"); raw != "" {
+		if window, err = time.ParseDuration(raw); err != nil || window < aggregate.MinWindow || window > aggregate.MaxWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "window must be a duration between " + aggregate.MinWindow.String() + " and " + aggregate.MaxWindow.String()})
+			return
+		}
+	}
+
+	filter, err := parseDataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	// The fields are aggregated instead of being projected as the grouping
+	// relies on the metadata fields
+	fields := filter.Fields
+	filter.Fields = nil
+
+	mux, ok := h.openWatch(c, h.watchDataUpstream(newSharedFilter(filter)))
+	if !ok {
+		return
+	}
+	defer mux.Close()
+
+	ctx := c.Request.Context()
+	out := mux.Out()
+
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	current := aggregate.NewWindow(groupBy, fields, time.Now())
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case now := <-ticker.C:
+			c.SSEvent("aggregate", current.Flush(now).Select(stats))
+			return true
+		case item, ok := <-out:
+			if !ok {
+				return false
+			}
+
+			switch item := item.(type) {
+			case fanout.Event:
+				c.SSEvent(item.Name, item.Data)
+			case *rpc.WatchDataResponse:
+				current.Add(item.Data)
+			}
+
+			return true
+		}
+	})
+}
+
+// AggregateSnapshot returns the data of the module rolled up over the last
+// complete window of the aggregation engine
+//
+// Only the modules applied through k8trics are aggregated in the
+// background, the dimension and the statistics are set by the params
+// described by aggregateQuery
+func (h *Handlers) AggregateSnapshot(c *gin.Context) {
+	groupBy, stats, err := aggregateQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	snapshot, ok := h.aggregator.Snapshot(c.Param("name"), groupBy)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"msg": "no aggregated data for module " + c.Param("name")})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot.Select(stats))
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+)
+
+// auditRecord takes in the verb, the module and the node filter of a
+// mutation and returns its audit record, the outcome is filled in once
+// the mutation is done
+//
+// The source IP is the address of the peer, the forwarded headers can be
+// set by any client hence they are only recorded alongside it
+func (h *Handlers) auditRecord(c *gin.Context, verb string, module *base.Module, filter discovery.NodeFilter) *audit.Record {
+	sourceIP := ""
+	if ip, _ := c.RemoteIP(); ip != nil {
+		sourceIP = ip.String()
+	}
+
+	record := audit.NewRecord(verb, requestSubject(c), sourceIP, module, h.discovery.Select(filter))
+	record.ForwardedFor = c.GetHeader("X-Forwarded-For")
+	return record
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sirupsen/logrus"
+)
+
+// subjectKey is the key of the authenticated subject in the gin context
+const subjectKey = "subject"
+
+// Authenticate is the middleware authenticating the caller of the
+// request, the request is aborted if the caller cannot be authenticated
+func (h *Handlers) Authenticate(c *gin.Context) {
+	subject, err := h.auth.Authenticate(c.Request.Context(), auth.CredentialsFromRequest(c.Request))
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			logrus.Warnf("failed to authenticate request: %s", err)
+		}
+
+		c.Header("WWW-Authenticate", `Bearer realm="k8trics"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": err.Error()})
+		return
+	}
+
+	c.Set(subjectKey, subject)
+	c.Next()
+}
+
+// authorize takes in the audit record of a mutation and the labels of the
+// module and returns true if the subject of the request is allowed to
+// perform the mutation, otherwise the denial is audited and the error is
+// written to the client
+func (h *Handlers) authorize(c *gin.Context, record *audit.Record, labels map[string]string) bool {
+	module := record.Core.GetName()
+
+	if err := h.auth.Authorize(record.Subject, record.Verb, module, labels); err != nil {
+		logrus.Infof("denied %s of module %s to %s", record.Verb, module, record.Subject.Name)
+		h.audit.Log(record.Deny(err))
+		c.JSON(http.StatusForbidden, gin.H{"msg": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// requestSubject returns the authenticated subject of the request
+func requestSubject(c *gin.Context) *auth.Subject {
+	if value, ok := c.Get(subjectKey); ok {
+		if subject, ok := value.(*auth.Subject); ok {
+			return subject
+		}
+	}
+
+	return &auth.Subject{Name: auth.Anonymous, Method: auth.MethodAnonymous}
+}
+
+// moduleLabels takes in a module and returns its labels, a module without
+// labels has an empty set of labels rather than unknown ones
+func moduleLabels(module *base.Module) map[string]string {
+	if labels := module.GetMetadata().GetLabels(); labels != nil {
+		return labels
+	}
+
+	return map[string]string{}
+}
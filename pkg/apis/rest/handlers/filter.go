@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// dataFilter restricts the items of the data streams to the ones produced
+// by specific pods and projects the data to a subset of its fields, it is
+// evaluated against the pod which produced the data
+//
+// Empty fields match every item. The nodes are not part of the filter as
+// the streams are opened only on the daemons of the targeted nodes, see
+// nodeFilter
+type dataFilter struct {
+	// Pod is the exact name of the pod
+	Pod string `json:"pod,omitempty"`
+	// PodPrefix is a prefix of the name of the pod
+	PodPrefix string `json:"podPrefix,omitempty"`
+	// Namespace is a comma separated list of namespaces of the pod
+	Namespace string `json:"namespace,omitempty"`
+	// Owner is the controller of the pod in the form of "kind/name" or
+	// just "name", eg. "Deployment/nginx"
+	Owner string `json:"owner,omitempty"`
+	// Selector is a kubernetes label selector of the pod
+	Selector string `json:"selector,omitempty"`
+	// Fields are the fields of the data which are forwarded to the client,
+	// empty means all of the fields
+	Fields []string `json:"fields,omitempty"`
+
+	namespaces map[string]struct{}
+	selector   labels.Selector
+}
+
+// parseDataFilter reads the optional "pod", "podPrefix", "namespace",
+// "owner", "selector" and "fields" query params and returns the data
+// filter for the request
+//
+// "namespace" and "fields" can be repeated or can be comma separated lists
+func parseDataFilter(c *gin.Context) (dataFilter, error) {
+	filter := dataFilter{
+		Pod:       c.Query("pod"),
+		PodPrefix: c.Query("podPrefix"),
+		Namespace: strings.Join(c.QueryArray("namespace"), ","),
+		Owner:     c.Query("owner"),
+		Selector:  c.Query("selector"),
+	}
+
+	for _, param := range c.QueryArray("fields") {
+		for _, field := range strings.Split(param, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				filter.Fields = append(filter.Fields, field)
+			}
+		}
+	}
+
+	return filter, filter.compile()
+}
+
+// compile validates the filter and prepares it to be applied, it must be
+// called before apply
+func (f *dataFilter) compile() error {
+	f.namespaces = nil
+	for _, namespace := range strings.Split(f.Namespace, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace == "" {
+			continue
+		}
+
+		if f.namespaces == nil {
+			f.namespaces = map[string]struct{}{}
+		}
+		f.namespaces[namespace] = struct{}{}
+	}
+
+	f.selector = nil
+	if f.Selector != "" {
+		selector, err := labels.Parse(f.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid pod selector: %w", err)
+		}
+
+		f.selector = selector
+	}
+
+	return nil
+}
+
+// apply takes in an item of a stream and returns the item which should be
+// forwarded to the client and false if the item must be skipped
+//
+// Only the data items are filtered, every other item is returned as is
+func (f dataFilter) apply(item interface{}) (interface{}, bool) {
+	resp, ok := item.(*rpc.WatchDataResponse)
+	if !ok {
+		return item, true
+	}
+
+	if !f.matches(resp) {
+		return nil, false
+	}
+
+	if len(f.Fields) == 0 {
+		return resp, true
+	}
+
+	// The data is projected into a copy so that the upstream items are
+	// never mutated
+	data := make(map[string]interface{}, len(f.Fields))
+	for _, field := range f.Fields {
+		if value, ok := resp.Data[field]; ok {
+			data[field] = value
+		}
+	}
+
+	return &rpc.WatchDataResponse{Data: data, Pod: resp.Pod}, true
+}
+
+// matches takes in a data item and returns true if the pod which produced
+// it matches the filter
+func (f dataFilter) matches(resp *rpc.WatchDataResponse) bool {
+	pod := resp.Pod
+	if pod == nil {
+		return f.Pod == "" && f.PodPrefix == "" && f.namespaces == nil && f.Owner == "" && f.selector == nil
+	}
+
+	if f.Pod != "" && pod.GetName() != f.Pod {
+		return false
+	}
+	if f.PodPrefix != "" && !strings.HasPrefix(pod.GetName(), f.PodPrefix) {
+		return false
+	}
+
+	if f.namespaces != nil {
+		if _, ok := f.namespaces[pod.GetNamespace()]; !ok {
+			return false
+		}
+	}
+
+	if f.Owner != "" {
+		owner, _ := resp.Data["owner"].(map[string]interface{})
+		kind, _ := owner["kind"].(string)
+		name, _ := owner["name"].(string)
+
+		if parts := strings.SplitN(f.Owner, "/", 2); len(parts) == 2 {
+			if !strings.EqualFold(kind, parts[0]) || name != parts[1] {
+				return false
+			}
+		} else if name != f.Owner {
+			return false
+		}
+	}
+
+	if f.selector != nil && !f.selector.Matches(labels.Set(pod.GetLabels())) {
+		return false
+	}
+
+	return true
+}
+
+// sharedFilter holds a data filter which can be replaced while the streams
+// using it are running
+type sharedFilter struct {
+	value atomic.Value
+}
+
+// newSharedFilter takes in a compiled data filter and returns a shared
+// filter holding it
+func newSharedFilter(filter dataFilter) *sharedFilter {
+	shared := &sharedFilter{}
+	shared.Store(filter)
+
+	return shared
+}
+
+// Load returns the current filter
+func (s *sharedFilter) Load() dataFilter {
+	return s.value.Load().(dataFilter)
+}
+
+// Store takes in a compiled data filter and replaces the current filter
+func (s *sharedFilter) Store(filter dataFilter) {
+	s.value.Store(filter)
+}
@@ -1,13 +1,92 @@
 package handlers
 
-import "github.com/sagacious-labs/k8trics/pkg/store"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sagacious-labs/k8trics/pkg/aggregate"
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanin"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/history"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/rollout"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/tracker"
+)
 
 type Handlers struct {
-	store *store.PodStore
+	store      *store.PodStore
+	pool       *rpc.Pool
+	discovery  *discovery.Discovery
+	exporter   *exporter.Exporter
+	tracker    *tracker.Tracker
+	fanout     *fanout.Fanout
+	registry   *registry.Registry
+	enricher   *enrich.Enricher
+	aggregator *aggregate.Engine
+	history    *history.Store
+	auth       *auth.Auth
+	audit      *audit.Logger
+	verifier   *release.Verifier
+
+	streamCfg     fanin.Config
+	rolloutPolicy rollout.Policy
+
+	metrics http.Handler
 }
 
-func New(store *store.PodStore) *Handlers {
+func New(store *store.PodStore, pool *rpc.Pool, discovery *discovery.Discovery, fanout *fanout.Fanout, exporter *exporter.Exporter, tracker *tracker.Tracker, registry *registry.Registry, enricher *enrich.Enricher, aggregator *aggregate.Engine, history *history.Store, auth *auth.Auth, audit *audit.Logger, verifier *release.Verifier) *Handlers {
+	metrics := prometheus.NewRegistry()
+	metrics.MustRegister(
+		exporter,
+		fanin.DroppedEvents,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
 	return &Handlers{
-		store: store,
+		store:         store,
+		pool:          pool,
+		discovery:     discovery,
+		exporter:      exporter,
+		tracker:       tracker,
+		fanout:        fanout,
+		registry:      registry,
+		enricher:      enricher,
+		aggregator:    aggregator,
+		history:       history,
+		auth:          auth,
+		audit:         audit,
+		verifier:      verifier,
+		streamCfg:     fanin.ConfigFromEnv(),
+		rolloutPolicy: rollout.PolicyFromEnv(),
+		metrics:       promhttp.HandlerFor(metrics, promhttp.HandlerOpts{}),
+	}
+}
+
+// newMux returns a multiplexer for the streams of the request, the
+// overflow policy can be overridden by the "overflow" query param
+func (h *Handlers) newMux(c *gin.Context) (*fanin.Mux, error) {
+	cfg := h.streamCfg
+
+	if raw := c.Query("overflow"); raw != "" {
+		policy, err := fanin.ParsePolicy(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Policy = policy
 	}
+
+	return fanin.New(c.Request.Context(), cfg), nil
 }
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz is the liveness endpoint, it reports healthy as long as the
+// server is able to serve requests
+func (h *Handlers) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz is the readiness endpoint, it reports ready once the pod
+// informer cache is synced and at least one hyperion daemon is available
+func (h *Handlers) Readyz(c *gin.Context) {
+	synced := h.tracker.Synced()
+
+	daemons := h.discovery.Daemons()
+	available := 0
+	for _, daemon := range daemons {
+		if daemon.Err == nil && h.pool.Healthy(daemon.Endpoint) {
+			available++
+		}
+	}
+
+	status := http.StatusOK
+	if !synced || available == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, gin.H{
+		"synced":    synced,
+		"daemons":   len(daemons),
+		"available": available,
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/history"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+)
+
+// DataRange returns the retained data of the module as JSON series, one
+// series per container of every pod
+//
+// "start" and "end" are RFC 3339 timestamps or unix seconds, they default
+// to the last 5 minutes. "step" is the resolution of the points, eg.
+// "15s", and defaults to the raw samples. The series can be filtered with
+// the params described by parseDataFilter, "fields" selects the fields of
+// the points
+func (h *Handlers) DataRange(c *gin.Context) {
+	now := time.Now()
+
+	end, err := parseTime(c.Query("end"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid end: " + err.Error()})
+		return
+	}
+
+	start, err := parseTime(c.Query("start"), end.Add(-5*time.Minute))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid start: " + err.Error()})
+		return
+	}
+
+	step := time.Duration(0)
+	if raw := c.Query("step"); raw != "" {
+		if step, err = time.ParseDuration(raw); err != nil || step < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": fmt.Sprintf("invalid step %q", raw)})
+			return
+		}
+	}
+
+	filter, err := parseDataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	series, err := h.history.Range(c.Param("name"), history.Query{
+		Start:  start,
+		End:    end,
+		Step:   step,
+		Fields: filter.Fields,
+		Match: func(metadata map[string]interface{}, pod *store.K8tricsPod) bool {
+			return filter.matches(&rpc.WatchDataResponse{Data: metadata, Pod: pod})
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start":  start,
+		"end":    end,
+		"step":   step.String(),
+		"series": series,
+	})
+}
+
+// parseTime takes in a RFC 3339 timestamp or unix seconds and returns the
+// time, the fallback is returned if the value is empty
+func parseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
@@ -3,16 +3,33 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/fanin"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
 	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
 	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/rollout"
 	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
+// applyResponse is the result of an Apply along with the coverage of
+// every node architecture
+type applyResponse struct {
+	*fanout.Result
+	Coverage []rollout.Coverage `json:"coverage"`
+}
+
+// Apply applies the module on the targeted daemons whose node architecture
+// has a release of the module, the other daemons are skipped or failed
+// according to the "unsupportedArch" query param
 func (h *Handlers) Apply(c *gin.Context) {
 	req := api.ApplyRequest{}
 	if err := c.Bind(&req); err != nil {
@@ -20,15 +37,68 @@ func (h *Handlers) Apply(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.performRequest(func(ep string) (interface{}, error) {
-		return rpc.HyperionApply(c.Request.Context(), &req, ep)
-	})
+	filter, err := nodeFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	policy := h.rolloutPolicy
+	if raw := c.Query("unsupportedArch"); raw != "" {
+		if policy, err = rollout.ParsePolicy(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+			return
+		}
+	}
+
+	name := req.GetModule().GetCore().GetName()
+	record := h.auditRecord(c, auth.VerbApply, req.GetModule(), filter)
+	if !h.authorize(c, record, moduleLabels(req.GetModule())) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, resp)
+	// Replacing a module requires being allowed to apply the module as it
+	// is as well, otherwise relabelling would get around the rules
+	if entry, ok := h.registry.Get(name); ok && !h.authorize(c, record, moduleLabels(entry.Module)) {
+		return
+	}
+
+	daemons := h.discovery.Select(filter)
+	if len(daemons) == 0 {
+		h.audit.Log(record.Reject(fanout.ErrNoDaemons))
+		c.JSON(errorStatus(fanout.ErrNoDaemons), gin.H{"msg": fanout.ErrNoDaemons.Error()})
+		return
+	}
+
+	if err := h.verifier.Verify(c.Request.Context(), req.GetModule()); err != nil {
+		h.audit.Log(record.Reject(err))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"msg": err.Error()})
+		return
+	}
+
+	plan := rollout.New(h.discovery, req.GetModule(), daemons)
+	if plan.Empty() {
+		err := fmt.Errorf("module %s has no release for the architecture of any of the targeted nodes", name)
+		h.audit.Log(record.Reject(err))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"msg": err.Error()})
+		return
+	}
+
+	resp := h.fanout.RequestDaemons(plan.Targets, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionApply(c.Request.Context(), &req, conn)
+	})
+	coverage := plan.Report(resp, policy)
+	h.audit.Log(record.Complete(resp))
+
+	if resp.Ok() && name != "" {
+		h.exporter.Subscribe(name)
+
+		if err := h.registry.Put(c.Request.Context(), req.GetModule(), filter, plan.Targets); err != nil {
+			logrus.Warnf("failed to record module %s in the registry: %s", name, err)
+		}
+	}
+
+	c.JSON(resp.Status(http.StatusCreated), applyResponse{Result: resp, Coverage: coverage})
 }
 
 func (h *Handlers) Delete(c *gin.Context) {
@@ -42,15 +112,45 @@ func (h *Handlers) Delete(c *gin.Context) {
 		Core: &base.ModuleCore{Name: moduleName},
 	}
 
-	resp, err := h.performRequest(func(ep string) (interface{}, error) {
-		return rpc.HyperionDelete(c.Request.Context(), &req, ep)
-	})
+	filter, err := nodeFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	// The labels of the module are only known if it is in the registry
+	module := &base.Module{Core: req.Core}
+	var labels map[string]string
+	if entry, ok := h.registry.Get(moduleName); ok {
+		module.Metadata = entry.Module.GetMetadata()
+		labels = moduleLabels(entry.Module)
+	}
+
+	record := h.auditRecord(c, auth.VerbDelete, module, filter)
+	if !h.authorize(c, record, labels) {
+		return
+	}
+
+	daemons := h.discovery.Select(filter)
+	resp := h.fanout.RequestDaemons(daemons, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionDelete(c.Request.Context(), &req, conn)
+	})
+	h.audit.Log(record.Complete(resp))
+
+	if resp.Ok() {
+		forgotten, err := h.registry.Delete(c.Request.Context(), moduleName, filter, daemons)
+		if err != nil {
+			logrus.Warnf("failed to remove module %s from the registry: %s", moduleName, err)
+		}
+
+		// The module is still running on the other nodes if only some of
+		// the nodes were targeted
+		if forgotten || filter.Empty() {
+			h.exporter.Unsubscribe(moduleName)
+		}
+	}
+
+	c.JSON(resp.Status(http.StatusOK), resp)
 }
 
 func (h *Handlers) Get(c *gin.Context) {
@@ -64,15 +164,35 @@ func (h *Handlers) Get(c *gin.Context) {
 		Core: &base.ModuleCore{Name: moduleName},
 	}
 
-	resp, err := h.performRequest(func(ep string) (interface{}, error) {
-		return rpc.HyperionGet(c.Request.Context(), &req, ep)
-	})
+	filter, err := nodeFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	resp := h.fanout.Request(filter, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionGet(c.Request.Context(), &req, conn)
+	})
+
+	c.JSON(resp.Status(http.StatusOK), resp)
+}
+
+// Status compares the module running on every daemon with the desired
+// state of the module and reports the daemons which have drifted
+func (h *Handlers) Status(c *gin.Context) {
+	moduleName := c.Param("name")
+	if moduleName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "module name is required"})
+		return
+	}
+
+	status := registry.Inspect(c.Request.Context(), h.registry, h.discovery, h.fanout, moduleName)
+	if !status.Desired && len(status.Nodes) == 0 {
+		c.JSON(http.StatusNotFound, status)
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, status)
 }
 
 func (h *Handlers) List(c *gin.Context) {
@@ -90,180 +210,201 @@ func (h *Handlers) List(c *gin.Context) {
 		},
 	}
 
-	resp, err := h.performRequestWithChannel(func(ep string) (chan interface{}, error) {
-		resp, err := rpc.HyperionList(c.Request.Context(), &req, ep)
-		ch := make(chan interface{}, 8)
-
-		go func() {
-			for data := range resp {
-				ch <- data
-			}
-		}()
+	filter, err := nodeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
 
-		return ch, err
-	})
+	mux, err := h.newMux(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
 		return
 	}
+	defer mux.Close()
 
-	c.Stream(func(w io.Writer) bool {
-		item, ok := <-resp
-		if !ok {
-			return false
+	err = h.fanout.Stream(mux, filter, func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+		resp, err := rpc.HyperionList(ctx, &req, conn)
+		if err != nil {
+			return err
 		}
 
-		c.SSEvent("module", item)
-		return true
+		for data := range resp {
+			if !emit(data) {
+				break
+			}
+		}
+
+		return nil
 	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"msg": err.Error()})
+		return
+	}
+
+	stream(c, "module", mux.Out())
 }
 
+// WatchData streams the data of the module as server sent events, the
+// data can be filtered and projected with the query params described by
+// parseDataFilter
 func (h *Handlers) WatchData(c *gin.Context) {
-	moduleName := c.Param("name")
-	if moduleName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"msg": "module name is a require parameter"})
+	filter, err := parseDataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
 		return
 	}
 
-	req := api.WatchDataRequest{
-		Filter: &base.ModuleCore{
-			Name: moduleName,
-		},
+	mux, ok := h.openWatch(c, h.watchDataUpstream(newSharedFilter(filter)))
+	if !ok {
+		return
 	}
+	defer mux.Close()
 
-	resp, err := h.performRequestWithChannel(func(ep string) (chan interface{}, error) {
-		ctx := context.WithValue(c.Request.Context(), "pod_store", h.store)
-		resp, err := rpc.HyperionWatchData(ctx, &req, ep)
-		ch := make(chan interface{}, 8)
-
-		go func() {
-			for data := range resp {
-				ch <- data
-			}
-		}()
+	stream(c, "data", mux.Out())
+}
 
-		return ch, err
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+func (h *Handlers) WatchLog(c *gin.Context) {
+	mux, ok := h.openWatch(c, h.watchLogUpstream)
+	if !ok {
 		return
 	}
+	defer mux.Close()
 
-	c.Stream(func(w io.Writer) bool {
-		item, ok := <-resp
-		if !ok {
-			return false
-		}
-
-		c.SSEvent("data", item)
-		return true
-	})
+	stream(c, "log", mux.Out())
 }
 
-func (h *Handlers) WatchLog(c *gin.Context) {
+// openWatch takes in a function returning the upstream for a module and
+// opens the watch streams of the module named in the request on every
+// targeted daemon
+//
+// If the watch cannot be opened then the error is written to the client
+// and false is returned, otherwise the caller must close the multiplexer
+func (h *Handlers) openWatch(c *gin.Context, upstream func(module string) fanout.Upstream) (*fanin.Mux, bool) {
 	moduleName := c.Param("name")
 	if moduleName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"msg": "module name is a require parameter"})
-		return
+		return nil, false
 	}
 
-	req := api.WatchLogRequest{
-		Filter: &base.ModuleCore{
-			Name: moduleName,
-		},
+	filter, err := nodeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return nil, false
 	}
 
-	resp, err := h.performRequestWithChannel(func(ep string) (chan interface{}, error) {
-		resp, err := rpc.HyperionWatchLog(c.Request.Context(), &req, ep)
-		ch := make(chan interface{}, 8)
-
-		go func() {
-			for data := range resp {
-				ch <- data
-			}
-		}()
-
-		return ch, err
-	})
+	mux, err := h.newMux(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
-		return
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return nil, false
 	}
 
-	c.Stream(func(w io.Writer) bool {
-		item, ok := <-resp
-		if !ok {
-			return false
-		}
+	if err := h.fanout.Watch(mux, filter, upstream(moduleName)); err != nil {
+		mux.Close()
+		c.JSON(errorStatus(err), gin.H{"msg": err.Error()})
+		return nil, false
+	}
 
-		c.SSEvent("log", item)
-		return true
-	})
+	return mux, true
 }
 
-func (h *Handlers) performRequest(fn func(ep string) (interface{}, error)) (interface{}, error) {
-	errs := []error{}
-	ress := []interface{}{}
-
-	for _, pod := range h.store.GetByLabels(map[string]string{
-		"core.hyperion.io/master": "true",
-	}) {
-		endpoint, err := pod.Endpoint()
-		if err != nil {
-			errs = append(errs, err)
-			continue
+// watchDataUpstream takes in a data filter and returns a function which
+// returns the upstream streaming the pod enriched data of a module
+//
+// The filter is evaluated before the data is merged so that the data of
+// the other pods does not take up room in the merged channel
+func (h *Handlers) watchDataUpstream(filter *sharedFilter) func(module string) fanout.Upstream {
+	return func(module string) fanout.Upstream {
+		req := api.WatchDataRequest{
+			Filter: &base.ModuleCore{
+				Name: module,
+			},
 		}
 
-		res, err := fn(endpoint)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
+		return func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+			ctx = context.WithValue(ctx, "enricher", h.enricher)
+			resp, streamErr, err := rpc.HyperionWatchData(ctx, &req, conn)
+			if err != nil {
+				return err
+			}
 
-		ress = append(ress, res)
-	}
+			for data := range resp {
+				fanout.Received(ctx)
 
-	return ress, mergeErrors(errs)
-}
+				item, ok := filter.Load().apply(data)
+				if !ok {
+					continue
+				}
 
-func (h *Handlers) performRequestWithChannel(fn func(ep string) (chan interface{}, error)) (chan interface{}, error) {
-	errs := []error{}
-	centralCh := make(chan interface{}, 8)
+				if !emit(item) {
+					return nil
+				}
+			}
 
-	for _, pod := range h.store.GetByLabels(map[string]string{
-		"core.hyperion.io/master": "true",
-	}) {
-		endpoint, err := pod.Endpoint()
-		if err != nil {
-			errs = append(errs, err)
-			continue
+			return streamErr()
 		}
+	}
+}
+
+// watchLogUpstream returns the upstream streaming the logs of the module
+func (h *Handlers) watchLogUpstream(module string) fanout.Upstream {
+	req := api.WatchLogRequest{
+		Filter: &base.ModuleCore{
+			Name: module,
+		},
+	}
 
-		res, err := fn(endpoint)
+	return func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error {
+		resp, streamErr, err := rpc.HyperionWatchLog(ctx, &req, conn)
 		if err != nil {
-			errs = append(errs, err)
-			continue
+			return err
 		}
 
-		go func() {
-			for data := range res {
-				centralCh <- data
+		for data := range resp {
+			fanout.Received(ctx)
+
+			if !emit(data) {
+				return nil
 			}
-		}()
-	}
+		}
 
-	return centralCh, mergeErrors(errs)
+		return streamErr()
+	}
 }
-func mergeErrors(errs []error) error {
-	if len(errs) == 0 {
-		return nil
+
+// errorStatus takes in an error returned by a request to the daemons and
+// returns the HTTP status code which should be returned to the client
+func errorStatus(err error) int {
+	if errors.Is(err, fanout.ErrNoDaemons) {
+		return http.StatusServiceUnavailable
 	}
 
-	errStrs := []string{}
+	return http.StatusInternalServerError
+}
+
+// stream takes in a channel and writes every item received on it to the
+// client as a server sent event until either the channel is closed or the
+// request context is cancelled, eg. when the client disconnects or when
+// the server is shutting down
+func stream(c *gin.Context, event string, ch <-chan interface{}) {
+	ctx := c.Request.Context()
 
-	for _, err := range errs {
-		errStrs = append(errStrs, err.Error())
-	}
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-ch:
+			if !ok {
+				return false
+			}
 
-	return errors.New(strings.Join(errStrs, "\n"))
+			if ev, ok := item.(fanout.Event); ok {
+				c.SSEvent(ev.Name, ev.Data)
+				return true
+			}
+
+			c.SSEvent(event, item)
+			return true
+		}
+	})
 }
@@ -0,0 +1,9 @@
+package handlers
+
+import "github.com/gin-gonic/gin"
+
+// Metrics serves the module data collected by the exporter along with
+// the process metrics in prometheus text exposition format
+func (h *Handlers) Metrics(c *gin.Context) {
+	h.metrics.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+)
+
+// nodeFilter reads the optional "node" and "nodeSelector" query params
+// and returns the node filter for the request
+//
+// "node" can be repeated or can be a comma separated list of node names
+// and "nodeSelector" is a kubernetes label selector, eg.
+// "kubernetes.io/arch=arm64,node-role.kubernetes.io/worker"
+func nodeFilter(c *gin.Context) (discovery.NodeFilter, error) {
+	return discovery.ParseNodeFilter(c.QueryArray("node"), c.Query("nodeSelector"))
+}
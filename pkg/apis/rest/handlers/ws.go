@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// wsWriteWait is the time allowed to write a message to the client
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is the time allowed to read the next pong or message from
+	// the client before the connection is considered dead
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is the interval of the pings, it must be less than
+	// wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize is the maximum size of a message from the client
+	wsMaxMessageSize = 4096
+)
+
+// upgrader upgrades the HTTP connections to WebSocket connections, cross
+// origin requests from browsers are rejected
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsMessage is a message written to the WebSocket clients
+type wsMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// wsCommand is a message read from a WebSocket client, the client sends a
+// data filter to replace the filter of the stream, the command carries the
+// new filter or the reason it was rejected
+type wsCommand struct {
+	filter dataFilter
+	err    error
+}
+
+// WatchDataWS streams the data of the module over a WebSocket connection
+//
+// The stream can be filtered with the query params described by
+// parseDataFilter and the client can replace the filter at any time by
+// sending it as a JSON message, eg.
+// {"podPrefix": "nginx-", "namespace": "default", "fields": ["cpu"]}
+func (h *Handlers) WatchDataWS(c *gin.Context) {
+	filter, err := parseDataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+
+	shared := newSharedFilter(filter)
+	h.watchWS(c, "data", shared, h.watchDataUpstream(shared))
+}
+
+// WatchLogWS streams the logs of the module over a WebSocket connection,
+// the logs are not filtered
+func (h *Handlers) WatchLogWS(c *gin.Context) {
+	h.watchWS(c, "log", newSharedFilter(dataFilter{}), h.watchLogUpstream)
+}
+
+// watchWS opens the watch streams of the module and writes every item to
+// the client over a WebSocket connection until the streams end, the client
+// disconnects or the server shuts down
+func (h *Handlers) watchWS(c *gin.Context, event string, filter *sharedFilter, upstream func(module string) fanout.Upstream) {
+	mux, ok := h.openWatch(c, upstream)
+	if !ok {
+		return
+	}
+	defer mux.Close()
+
+	// Upgrade replies to the client by itself on failure
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logrus.Debug("failed to upgrade websocket connection: ", err)
+		return
+	}
+	defer conn.Close()
+
+	cmds := make(chan wsCommand)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	defer close(quit)
+
+	go readWS(conn, filter, cmds, quit, done)
+
+	writeWS(c.Request.Context(), conn, event, mux.Out(), cmds, done)
+}
+
+// readWS reads the filters sent by the client, replaces the shared filter
+// and forwards them as commands to be acknowledged until the connection
+// fails or quit is closed, done is closed once the connection fails
+//
+// Reading is also what processes the pongs of the client, hence the
+// connection is considered dead if nothing is read for wsPongWait
+func readWS(conn *websocket.Conn, filter *sharedFilter, cmds chan<- wsCommand, quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logrus.Debug("websocket connection failed: ", err)
+			}
+
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		cmd := wsCommand{}
+		if cmd.err = json.Unmarshal(msg, &cmd.filter); cmd.err == nil {
+			cmd.err = cmd.filter.compile()
+		}
+
+		if cmd.err == nil {
+			filter.Store(cmd.filter)
+		}
+
+		select {
+		case cmds <- cmd:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// writeWS is the only writer of the connection, it writes the items of
+// the stream, the replies to the commands of the client and the pings
+func writeWS(ctx context.Context, conn *websocket.Conn, event string, out <-chan interface{}, cmds <-chan wsCommand, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			closeWS(conn, websocket.CloseGoingAway, "server is shutting down")
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case cmd := <-cmds:
+			msg := wsMessage{Event: "filter", Data: cmd.filter}
+			if cmd.err != nil {
+				msg = wsMessage{Event: "error", Data: gin.H{"msg": "invalid filter: " + cmd.err.Error()}}
+			}
+
+			if err := sendWS(conn, msg); err != nil {
+				return
+			}
+		case item, ok := <-out:
+			if !ok {
+				closeWS(conn, websocket.CloseNormalClosure, "stream ended")
+				return
+			}
+
+			msg := wsMessage{Event: event, Data: item}
+			if ev, ok := item.(fanout.Event); ok {
+				msg = wsMessage{Event: ev.Name, Data: ev.Data}
+			}
+
+			if err := sendWS(conn, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendWS takes in a message and writes it to the client as JSON
+func sendWS(conn *websocket.Conn, msg wsMessage) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+// closeWS takes in a close code and a reason and sends the close message
+// to the client
+func closeWS(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
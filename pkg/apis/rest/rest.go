@@ -1,17 +1,113 @@
 package rest
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/sagacious-labs/k8trics/pkg/aggregate"
 	"github.com/sagacious-labs/k8trics/pkg/apis/rest/handlers"
 	"github.com/sagacious-labs/k8trics/pkg/apis/rest/routes"
+	"github.com/sagacious-labs/k8trics/pkg/audit"
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/history"
+	"github.com/sagacious-labs/k8trics/pkg/registry"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
 	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/tracker"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
-func Run(store *store.PodStore) {
+// Run starts the REST server and blocks until the given context is
+// cancelled, after which the server is shut down gracefully
+//
+// On shutdown the long running streams, ie. the SSE and the websocket
+// streams, are cancelled so that the upstream hyperion streams are torn
+// down while the other in-flight requests are left to finish, the server
+// waits for at most shutdownTimeout for them
+//
+// The server serves TLS if the TLS configuration is not nil
+func Run(ctx context.Context, store *store.PodStore, pool *rpc.Pool, discovery *discovery.Discovery, fanout *fanout.Fanout, exporter *exporter.Exporter, tracker *tracker.Tracker, registry *registry.Registry, enricher *enrich.Enricher, aggregator *aggregate.Engine, history *history.Store, auth *auth.Auth, audit *audit.Logger, verifier *release.Verifier, tlsConfig *tls.Config, shutdownTimeout time.Duration) error {
 	router := gin.Default()
-	handlers := handlers.New(store)
+	// The forwarded headers can be set by any client, the client IP must be
+	// the address of the peer as it is audited
+	router.ForwardedByClientIP = false
+	router.TrustedProxies = nil
+	handlers := handlers.New(store, pool, discovery, fanout, exporter, tracker, registry, enricher, aggregator, history, auth, audit, verifier)
+
+	// The streams never finish on their own, they are cancelled as soon as
+	// the shutdown starts
+	streamsCtx, cancelStreams := context.WithCancel(context.Background())
+	defer cancelStreams()
+
+	routes.NewRoutes(router, handlers, cancelOnShutdown(streamsCtx))
+
+	srv := &http.Server{
+		Addr:      fmt.Sprintf(":%s", utils.GetEnv("PORT", "8080")),
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+	srv.RegisterOnShutdown(cancelStreams)
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			logrus.Infof("Listening and serving HTTPS on %s", srv.Addr)
+			// The certificate is provided by the TLS configuration
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			logrus.Infof("Listening and serving HTTP on %s", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infoln("Shutting down the REST server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return srv.Shutdown(shutdownCtx)
+}
+
+// cancelOnShutdown takes in the context of the streams and returns a
+// middleware which cancels the request context once the streams context
+// is cancelled
+func cancelOnShutdown(streams context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
 
-	routes.NewRoutes(router, handlers)
+		go func() {
+			select {
+			case <-streams.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
 
-	router.Run()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
 }
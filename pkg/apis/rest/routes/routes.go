@@ -5,18 +5,38 @@ import (
 	"github.com/sagacious-labs/k8trics/pkg/apis/rest/handlers"
 )
 
-func NewRoutes(r *gin.Engine, handlers *handlers.Handlers) {
+// NewRoutes takes in the router, the handlers and the middleware of the
+// long running streams and sets up every route
+func NewRoutes(r *gin.Engine, handlers *handlers.Handlers, streaming gin.HandlerFunc) {
 	// Setup v1 api routes
-	v1ApiRoutes(r, handlers)
+	v1ApiRoutes(r, handlers, streaming)
+
+	// Setup prometheus metrics route
+	r.GET("/metrics", handlers.Metrics)
+
+	// Setup health check routes
+	r.GET("/healthz", handlers.Healthz)
+	r.GET("/readyz", handlers.Readyz)
 }
 
-func v1ApiRoutes(r *gin.Engine, handlers *handlers.Handlers) {
-	v1 := r.Group("/api/v1")
+func v1ApiRoutes(r *gin.Engine, handlers *handlers.Handlers, streaming gin.HandlerFunc) {
+	// The metrics and health check routes are left unauthenticated for the
+	// scrapers and the kubelet
+	v1 := r.Group("/api/v1", handlers.Authenticate)
 
 	v1.GET("/module", handlers.List)
 	v1.GET("/module/:name", handlers.Get)
-	v1.GET("/module/:name/log", handlers.WatchLog)
-	v1.GET("/module/:name/data", handlers.WatchData)
+	v1.GET("/module/:name/status", handlers.Status)
+	v1.GET("/module/:name/data/aggregate/snapshot", handlers.AggregateSnapshot)
+	v1.GET("/module/:name/data/range", handlers.DataRange)
 	v1.DELETE("/module/:name", handlers.Delete)
 	v1.POST("/module", handlers.Apply)
+
+	// The streams are cancelled on shutdown rather than waited for
+	streams := v1.Group("", streaming)
+	streams.GET("/module/:name/log", handlers.WatchLog)
+	streams.GET("/module/:name/data", handlers.WatchData)
+	streams.GET("/module/:name/log/ws", handlers.WatchLogWS)
+	streams.GET("/module/:name/data/ws", handlers.WatchDataWS)
+	streams.GET("/module/:name/data/aggregate", handlers.WatchAggregate)
 }
@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/auth"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// OutcomeSucceeded means that the mutation succeeded on every daemon
+	OutcomeSucceeded = "succeeded"
+	// OutcomePartial means that the mutation failed on some of the daemons
+	OutcomePartial = "partial"
+	// OutcomeFailed means that the mutation failed on every daemon or that
+	// there were no daemons
+	OutcomeFailed = "failed"
+	// OutcomeDenied means that the mutation was not allowed for the caller
+	OutcomeDenied = "denied"
+	// OutcomeRejected means that the mutation was rejected before any of
+	// the daemons was contacted, eg. due to an invalid module
+	OutcomeRejected = "rejected"
+)
+
+// Record is the audit record of an Apply or a Delete
+type Record struct {
+	Time time.Time `json:"time"`
+	// Verb is either "apply" or "delete"
+	Verb    string        `json:"verb"`
+	Subject *auth.Subject `json:"subject"`
+	// SourceIP is the address of the peer which sent the request
+	SourceIP string `json:"sourceIP"`
+	// ForwardedFor is the X-Forwarded-For header of the request, it is
+	// set by the client or the proxies and cannot be trusted
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+
+	Core     *base.ModuleCore     `json:"core"`
+	Metadata *base.ModuleMetadata `json:"metadata,omitempty"`
+	// Releases are the SHA256 of the module release of every architecture
+	Releases map[string]string `json:"releases,omitempty"`
+
+	// Targets are the daemons the mutation was meant for
+	Targets []Target `json:"targets"`
+	// Results are the outcomes on the daemons which were contacted
+	Results []fanout.DaemonResult `json:"results,omitempty"`
+	// Skipped are the targeted nodes which were not contacted
+	Skipped []string `json:"skipped,omitempty"`
+	Outcome string   `json:"outcome"`
+	// Msg is the reason the mutation was denied, rejected or failed
+	Msg string `json:"msg,omitempty"`
+}
+
+// NewRecord takes in the verb, the subject and the source IP of a
+// mutation along with its module and the targeted daemons and returns its
+// audit record, the outcome is filled in once the mutation is done
+func NewRecord(verb string, subject *auth.Subject, sourceIP string, module *base.Module, daemons []discovery.Daemon) *Record {
+	targets := []Target{}
+	for _, daemon := range daemons {
+		targets = append(targets, NewTarget(daemon.Pod))
+	}
+
+	return &Record{
+		Verb:     verb,
+		Subject:  subject,
+		SourceIP: sourceIP,
+		Core:     module.GetCore(),
+		Metadata: module.GetMetadata(),
+		Releases: Releases(module.GetMetadata()),
+		Targets:  targets,
+	}
+}
+
+// Target is a daemon targeted by a mutation
+type Target struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node"`
+
+	pod store.K8tricsPod
+}
+
+// NewTarget takes in a daemon pod and returns the target
+func NewTarget(pod store.K8tricsPod) Target {
+	return Target{
+		Pod:       pod.GetName(),
+		Namespace: pod.GetNamespace(),
+		Node:      pod.Spec.NodeName,
+		pod:       pod,
+	}
+}
+
+// Releases takes in the metadata of a module and returns the SHA256 of its
+// releases keyed by the architecture
+func Releases(metadata *base.ModuleMetadata) map[string]string {
+	releases := map[string]string{}
+
+	for arch, r := range release.Releases(&base.Module{Metadata: metadata}) {
+		if sha := r.GetSha256(); sha != "" {
+			releases[arch] = sha
+		}
+	}
+
+	return releases
+}
+
+// Outcome takes in the result of a mutation and returns its outcome
+func Outcome(result *fanout.Result) string {
+	switch {
+	case !result.Ok():
+		return OutcomeFailed
+	case len(result.Failed) > 0:
+		return OutcomePartial
+	default:
+		return OutcomeSucceeded
+	}
+}
+
+// Sink writes the audit records somewhere
+type Sink interface {
+	Write(record *Record) error
+}
+
+// Logger writes the audit records to every sink, the failures of the sinks
+// are logged and do not fail the mutations
+type Logger struct {
+	sinks []Sink
+}
+
+// New takes in the sinks and returns a new instance of Logger, a Logger
+// without sinks drops every record
+func New(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// FromEnv reads the environmental variables and returns the Logger writing
+// to the configured sinks
+//
+//   - K8TRICS_AUDIT_FILE: path of the JSON lines file, the file is rotated
+//     once it reaches K8TRICS_AUDIT_MAX_BYTES and K8TRICS_AUDIT_MAX_BACKUPS
+//     of the rotated files are kept
+//   - K8TRICS_AUDIT_EVENTS: set to "true" to also emit the records as
+//     Kubernetes Events on the targeted daemon pods
+func FromEnv(clientset kubernetes.Interface) (*Logger, error) {
+	sinks := []Sink{}
+
+	if path := utils.GetEnv("K8TRICS_AUDIT_FILE", ""); path != "" {
+		file, err := NewFileSink(
+			path,
+			int64(utils.GetEnvInt("K8TRICS_AUDIT_MAX_BYTES", 100*1024*1024)),
+			utils.GetEnvInt("K8TRICS_AUDIT_MAX_BACKUPS", 5),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, file)
+	}
+
+	if utils.GetEnv("K8TRICS_AUDIT_EVENTS", "false") == "true" {
+		sinks = append(sinks, NewEventSink(clientset))
+	}
+
+	if len(sinks) == 0 {
+		logrus.Warnln("no audit sinks are configured, the module mutations are not audited")
+	}
+
+	return New(sinks...), nil
+}
+
+// Log takes in an audit record and writes it to every sink
+func (l *Logger) Log(record *Record) {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(record); err != nil {
+			logrus.Errorf("failed to write audit record of %s of module %s: %s", record.Verb, record.Core.GetName(), err)
+		}
+	}
+}
+
+// Close closes the sinks which hold resources
+func (l *Logger) Close() {
+	for _, sink := range l.sinks {
+		if closer, ok := sink.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logrus.Warnf("failed to close audit sink: %s", err)
+			}
+		}
+	}
+}
+
+// Deny takes in the reason a mutation was not allowed and marks the record
+// as denied
+func (r *Record) Deny(err error) *Record {
+	r.Outcome = OutcomeDenied
+	r.Msg = err.Error()
+	return r
+}
+
+// Reject takes in the reason a mutation was rejected before contacting any
+// of the daemons and marks the record as rejected
+func (r *Record) Reject(err error) *Record {
+	r.Outcome = OutcomeRejected
+	r.Msg = err.Error()
+	return r
+}
+
+// Complete takes in the result of a mutation and records the outcome on
+// every daemon
+func (r *Record) Complete(result *fanout.Result) *Record {
+	r.Results = result.Results
+	r.Skipped = result.Skipped
+	r.Outcome = Outcome(result)
+	r.Msg = result.Msg
+	return r
+}
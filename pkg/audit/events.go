@@ -0,0 +1,80 @@
+package audit
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// reasons are the reasons of the events of the succeeded and the failed
+// mutations keyed by the verb
+var reasons = map[string][2]string{
+	"apply":  {"ModuleApplied", "ModuleApplyFailed"},
+	"delete": {"ModuleDeleted", "ModuleDeleteFailed"},
+}
+
+// EventSink emits the audit records as Kubernetes Events on the targeted
+// daemon pods, so that `kubectl describe` of a daemon shows which modules
+// were applied to it and by whom
+//
+// The events are emitted asynchronously by the event broadcaster, which
+// also rate limits and aggregates them
+type EventSink struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+// NewEventSink takes in the kubernetes clientset and returns a new
+// instance of EventSink
+func NewEventSink(clientset kubernetes.Interface) *EventSink {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: clientset.CoreV1().Events(""),
+	})
+
+	return &EventSink{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "k8trics"}),
+	}
+}
+
+// Write implements Sink, an event is emitted on every targeted daemon
+// which was contacted
+func (s *EventSink) Write(record *Record) error {
+	outcomes := map[string]string{}
+	for _, result := range record.Results {
+		outcomes[result.Pod] = result.Error
+	}
+
+	reason, ok := reasons[record.Verb]
+	if !ok {
+		return nil
+	}
+
+	for _, target := range record.Targets {
+		errMsg, ok := outcomes[target.Pod]
+		if !ok || target.pod.GetName() == "" {
+			continue
+		}
+
+		pod := target.pod.Pod
+		if errMsg != "" {
+			s.recorder.Eventf(&pod, corev1.EventTypeWarning, reason[1],
+				"%s of module %s by %s failed: %s", record.Verb, record.Core.GetName(), record.Subject.Name, errMsg)
+			continue
+		}
+
+		s.recorder.Eventf(&pod, corev1.EventTypeNormal, reason[0],
+			"%s of module %s by %s succeeded", record.Verb, record.Core.GetName(), record.Subject.Name)
+	}
+
+	return nil
+}
+
+// Close stops the event broadcaster
+func (s *EventSink) Close() error {
+	s.broadcaster.Shutdown()
+	return nil
+}
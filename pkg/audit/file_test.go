@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+)
+
+// newRecord takes in the name of a module and returns an audit record of
+// its apply
+func newRecord(module string) *Record {
+	return &Record{Verb: "apply", Core: &base.ModuleCore{Name: module}}
+}
+
+// readModules takes in the path of an audit file and returns the names of
+// the modules of its records, nil if the file does not exist
+func readModules(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+
+	modules := []string{}
+	for decoder := json.NewDecoder(file); decoder.More(); {
+		record := &Record{}
+		if err := decoder.Decode(record); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		modules = append(modules, record.Core.GetName())
+	}
+
+	return modules
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	// Every file holds a single record as the records have the same size
+	line, err := json.Marshal(newRecord("module-0"))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	maxBytes := int64(len(line) + 1)
+
+	tests := []struct {
+		name       string
+		maxBackups int
+		want       [][]string
+	}{
+		{
+			name:       "backups are shifted and the oldest is dropped",
+			maxBackups: 2,
+			want:       [][]string{{"module-4"}, {"module-3"}, {"module-2"}, nil},
+		},
+		{
+			name:       "no backups",
+			maxBackups: 0,
+			want:       [][]string{{"module-4"}, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+			sink, err := NewFileSink(path, maxBytes, tt.maxBackups)
+			if err != nil {
+				t.Fatalf("NewFileSink() error = %v", err)
+			}
+
+			for i := 1; i <= 4; i++ {
+				if err := sink.Write(newRecord(fmt.Sprintf("module-%d", i))); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			if err := sink.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			for i, want := range tt.want {
+				file := path
+				if i > 0 {
+					file = fmt.Sprintf("%s.%d", path, i)
+				}
+
+				got := readModules(t, file)
+				if fmt.Sprint(got) != fmt.Sprint(want) || (got == nil) != (want == nil) {
+					t.Errorf("%s = %v, want %v", filepath.Base(file), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 1; i <= 2; i++ {
+		sink, err := NewFileSink(path, 1024*1024, 1)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+
+		if err := sink.Write(newRecord(fmt.Sprintf("module-%d", i))); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	if got := readModules(t, path); fmt.Sprint(got) != "[module-1 module-2]" {
+		t.Errorf("audit.log = %v, want the records of both sinks", got)
+	}
+}
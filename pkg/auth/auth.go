@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Anonymous is the subject of the requests without credentials
+const Anonymous = "system:anonymous"
+
+var (
+	// ErrUnauthenticated is returned when the caller of a request cannot be
+	// authenticated
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned when the subject is not allowed to perform
+	// a request
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Auth authenticates the callers of the REST API and authorizes the
+// mutations of the modules
+type Auth struct {
+	authenticators []Authenticator
+	anonymous      bool
+	rules          []Rule
+}
+
+// FromEnv reads the path of the auth configuration from K8TRICS_AUTH_CONFIG
+// and returns the Auth configured by it
+//
+// If the variable is not set then the authentication and authorization are
+// disabled and every request is made as the anonymous subject
+func FromEnv(clientset kubernetes.Interface) (*Auth, error) {
+	path := utils.GetEnv("K8TRICS_AUTH_CONFIG", "")
+	if path == "" {
+		logrus.Warnln("K8TRICS_AUTH_CONFIG is not set, the REST API is not authenticated")
+		return Disabled(), nil
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg, clientset), nil
+}
+
+// Disabled returns an Auth which allows every request as the anonymous
+// subject
+func Disabled() *Auth {
+	return &Auth{anonymous: true}
+}
+
+// New takes in the auth configuration and the kubernetes clientset, which
+// is used for the TokenReviews, and returns a new instance of Auth
+func New(cfg *Config, clientset kubernetes.Interface) *Auth {
+	a := &Auth{
+		anonymous: cfg.Authentication.Anonymous,
+		rules:     cfg.Authorization.Rules,
+	}
+
+	if cfg.Authentication.ClientCert.Enabled {
+		a.authenticators = append(a.authenticators, clientCertAuthenticator{})
+	}
+
+	if len(cfg.Authentication.Tokens) > 0 {
+		a.authenticators = append(a.authenticators, &tokenAuthenticator{tokens: cfg.Authentication.Tokens})
+	}
+
+	if cfg.Authentication.TokenReview.Enabled {
+		a.authenticators = append(a.authenticators, newTokenReviewAuthenticator(clientset, cfg.Authentication.TokenReview.Audiences))
+	}
+
+	return a
+}
+
+// Authenticate takes in the credentials of a request and returns its
+// subject, the authenticators are tried in order and the first one to
+// recognise the credentials decides
+//
+// A request whose credentials are not recognised by any authenticator is
+// rejected even if anonymous requests are allowed
+func (a *Auth) Authenticate(ctx context.Context, creds Credentials) (*Subject, error) {
+	for _, authenticator := range a.authenticators {
+		subject, ok, err := authenticator.Authenticate(ctx, creds)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return subject, nil
+		}
+	}
+
+	if creds.bearerToken() != "" {
+		return nil, fmt.Errorf("%w: invalid bearer token", ErrUnauthenticated)
+	}
+
+	if !a.anonymous {
+		return nil, fmt.Errorf("%w: credentials are required", ErrUnauthenticated)
+	}
+
+	return &Subject{Name: Anonymous, Method: MethodAnonymous}, nil
+}
+
+// Authorize takes in a subject, a verb, the name of a module and the
+// labels of the module and returns an error if the subject is not allowed
+// to perform the verb on the module
+//
+// The labels are nil if they are unknown, eg. when deleting a module which
+// is not in the registry, in which case only the rules without a module
+// selector can allow the request
+func (a *Auth) Authorize(subject *Subject, verb, module string, labels map[string]string) error {
+	if len(a.rules) == 0 {
+		return nil
+	}
+
+	for i := range a.rules {
+		if a.rules[i].allows(subject, verb, module, labels) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s cannot %s module %s", ErrForbidden, subject.Name, verb, module)
+}
+
+type subjectKey struct{}
+
+// NewContext takes in a context and a subject and returns a context
+// carrying the subject
+func NewContext(ctx context.Context, subject *Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// FromContext takes in a context and returns the subject it carries, the
+// anonymous subject is returned if there is none
+func FromContext(ctx context.Context) *Subject {
+	if subject, ok := ctx.Value(subjectKey{}).(*Subject); ok {
+		return subject
+	}
+
+	return &Subject{Name: Anonymous, Method: MethodAnonymous}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tokens := []TokenConfig{{Token: "s3cr3t", Subject: "alice", Groups: []string{"netops"}}}
+
+	tests := []struct {
+		name      string
+		cfg       *Config
+		creds     Credentials
+		want      string
+		wantErr   error
+		wantGroup string
+	}{
+		{
+			name:      "valid token",
+			cfg:       &Config{Authentication: AuthenticationConfig{Tokens: tokens}},
+			creds:     Credentials{Authorization: "Bearer s3cr3t"},
+			want:      "alice",
+			wantGroup: "netops",
+		},
+		{
+			name:  "bearer scheme is case insensitive",
+			cfg:   &Config{Authentication: AuthenticationConfig{Tokens: tokens}},
+			creds: Credentials{Authorization: "bearer s3cr3t"},
+			want:  "alice",
+		},
+		{
+			name:    "unrecognised token",
+			cfg:     &Config{Authentication: AuthenticationConfig{Tokens: tokens}},
+			creds:   Credentials{Authorization: "Bearer wrong"},
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:    "unrecognised token with anonymous allowed",
+			cfg:     &Config{Authentication: AuthenticationConfig{Anonymous: true, Tokens: tokens}},
+			creds:   Credentials{Authorization: "Bearer wrong"},
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:    "unrecognised token without authenticators and anonymous allowed",
+			cfg:     &Config{Authentication: AuthenticationConfig{Anonymous: true}},
+			creds:   Credentials{Authorization: "Bearer wrong"},
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name:    "no credentials",
+			cfg:     &Config{Authentication: AuthenticationConfig{Tokens: tokens}},
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			name: "no credentials with anonymous allowed",
+			cfg:  &Config{Authentication: AuthenticationConfig{Anonymous: true, Tokens: tokens}},
+			want: Anonymous,
+		},
+		{
+			name:  "unsupported scheme with anonymous allowed",
+			cfg:   &Config{Authentication: AuthenticationConfig{Anonymous: true, Tokens: tokens}},
+			creds: Credentials{Authorization: "Basic YWxpY2U6czNjcjN0"},
+			want:  Anonymous,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := New(tt.cfg, nil).Authenticate(context.Background(), tt.creds)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if subject.Name != tt.want {
+				t.Errorf("Authenticate() = %s, want %s", subject.Name, tt.want)
+			}
+
+			if tt.wantGroup != "" && (len(subject.Groups) != 1 || subject.Groups[0] != tt.wantGroup) {
+				t.Errorf("Authenticate() groups = %v, want [%s]", subject.Groups, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	rules := []Rule{
+		{Subjects: []string{"group:netops"}, Verbs: []string{"*"}, ModuleSelector: "team=netops"},
+		{Subjects: []string{"bob"}, Verbs: []string{VerbDelete}, Modules: []string{"tcp-rtt"}},
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatalf("compile() error = %v", err)
+		}
+	}
+
+	a := New(&Config{Authorization: AuthorizationConfig{Rules: rules}}, nil)
+
+	alice := &Subject{Name: "alice", Groups: []string{"netops"}}
+	bob := &Subject{Name: "bob"}
+
+	tests := []struct {
+		name    string
+		subject *Subject
+		verb    string
+		module  string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "allowed by group and selector", subject: alice, verb: VerbApply, module: "tcp-rtt", labels: map[string]string{"team": "netops"}},
+		{name: "selector does not match", subject: alice, verb: VerbApply, module: "tcp-rtt", labels: map[string]string{"team": "storage"}, wantErr: true},
+		{name: "allowed by subject and module", subject: bob, verb: VerbDelete, module: "tcp-rtt"},
+		{name: "verb not allowed", subject: bob, verb: VerbApply, module: "tcp-rtt", wantErr: true},
+		{name: "module not allowed", subject: bob, verb: VerbDelete, module: "dns-latency", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Authorize(tt.subject, tt.verb, tt.module, tt.labels)
+			if tt.wantErr && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Authorize() error = %v, want %v", err, ErrForbidden)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Authorize() error = %v", err)
+			}
+		})
+	}
+
+	if err := Disabled().Authorize(bob, VerbApply, "tcp-rtt", nil); err != nil {
+		t.Errorf("Disabled().Authorize() error = %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MethodToken is the method of the subjects authenticated by a static
+	// bearer token
+	MethodToken = "token"
+	// MethodTokenReview is the method of the subjects authenticated by the
+	// Kubernetes TokenReview API
+	MethodTokenReview = "tokenreview"
+	// MethodClientCert is the method of the subjects authenticated by a
+	// TLS client certificate
+	MethodClientCert = "clientcert"
+	// MethodAnonymous is the method of the anonymous subject
+	MethodAnonymous = "anonymous"
+)
+
+// tokenReviewTTL is how long the result of a TokenReview is cached
+const tokenReviewTTL = time.Minute
+
+// Subject is the authenticated caller of a request
+type Subject struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
+	// Method is how the subject was authenticated
+	Method string `json:"method"`
+}
+
+// Credentials are the credentials carried by a request, they are
+// extracted from either an HTTP request or a gRPC call so that both APIs
+// share the authenticators
+type Credentials struct {
+	// Authorization is the value of the Authorization header or metadata
+	Authorization string
+	// TLS is the state of the TLS connection, nil in plaintext
+	TLS *tls.ConnectionState
+}
+
+// CredentialsFromRequest takes in an HTTP request and returns its
+// credentials
+func CredentialsFromRequest(r *http.Request) Credentials {
+	return Credentials{
+		Authorization: r.Header.Get("Authorization"),
+		TLS:           r.TLS,
+	}
+}
+
+// Authenticator authenticates the caller of a request
+type Authenticator interface {
+	// Authenticate takes in the credentials of a request and returns the
+	// subject, if the request does not carry the credentials handled by
+	// the authenticator then false is returned, if the credentials are
+	// invalid then an error is returned
+	Authenticate(ctx context.Context, creds Credentials) (*Subject, bool, error)
+}
+
+// bearerToken returns the token in the Authorization header, it is empty
+// if there is none
+func (c Credentials) bearerToken() string {
+	parts := strings.SplitN(c.Authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+// tokenAuthenticator authenticates the static bearer tokens of the
+// configuration
+type tokenAuthenticator struct {
+	tokens []TokenConfig
+}
+
+func (a *tokenAuthenticator) Authenticate(_ context.Context, creds Credentials) (*Subject, bool, error) {
+	token := creds.bearerToken()
+	if token == "" {
+		return nil, false, nil
+	}
+
+	// Every token is compared to not leak which one matched through timing
+	var match *TokenConfig
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(a.tokens[i].Token), []byte(token)) == 1 {
+			match = &a.tokens[i]
+		}
+	}
+
+	if match == nil {
+		return nil, false, nil
+	}
+
+	return &Subject{Name: match.Subject, Groups: match.Groups, Method: MethodToken}, true, nil
+}
+
+// tokenReviewAuthenticator authenticates the bearer tokens, eg. the
+// ServiceAccount tokens, through the Kubernetes TokenReview API
+//
+// The reviews are cached for tokenReviewTTL keyed by the hash of the token
+// so that the API server is not hit by every request
+type tokenReviewAuthenticator struct {
+	clientset kubernetes.Interface
+	audiences []string
+
+	cache map[string]tokenReview
+	lock  sync.Mutex
+
+	// now returns the current time, it is replaced in the tests
+	now func() time.Time
+}
+
+type tokenReview struct {
+	subject *Subject
+	expires time.Time
+}
+
+func newTokenReviewAuthenticator(clientset kubernetes.Interface, audiences []string) *tokenReviewAuthenticator {
+	return &tokenReviewAuthenticator{
+		clientset: clientset,
+		audiences: audiences,
+		cache:     map[string]tokenReview{},
+		now:       time.Now,
+	}
+}
+
+func (a *tokenReviewAuthenticator) Authenticate(ctx context.Context, creds Credentials) (*Subject, bool, error) {
+	token := creds.bearerToken()
+	if token == "" {
+		return nil, false, nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	if review, ok := a.cached(key); ok {
+		return review.subject, review.subject != nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := a.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to review token: %w", err)
+	}
+
+	// The rejected tokens are cached as well so that a misbehaving client
+	// does not turn into a review per request
+	var subject *Subject
+	if resp.Status.Authenticated {
+		subject = &Subject{
+			Name:   resp.Status.User.Username,
+			Groups: resp.Status.User.Groups,
+			Method: MethodTokenReview,
+		}
+	}
+
+	a.store(key, subject)
+	return subject, subject != nil, nil
+}
+
+func (a *tokenReviewAuthenticator) cached(key string) (tokenReview, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	review, ok := a.cache[key]
+	if !ok || a.now().After(review.expires) {
+		return tokenReview{}, false
+	}
+
+	return review, true
+}
+
+func (a *tokenReviewAuthenticator) store(key string, subject *Subject) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := a.now()
+	for k, review := range a.cache {
+		if now.After(review.expires) {
+			delete(a.cache, k)
+		}
+	}
+
+	a.cache[key] = tokenReview{subject: subject, expires: now.Add(tokenReviewTTL)}
+}
+
+// clientCertAuthenticator authenticates the verified TLS client
+// certificates, the common name is the subject and the organizations are
+// the groups
+type clientCertAuthenticator struct{}
+
+func (clientCertAuthenticator) Authenticate(_ context.Context, creds Credentials) (*Subject, bool, error) {
+	if creds.TLS == nil || len(creds.TLS.VerifiedChains) == 0 || len(creds.TLS.VerifiedChains[0]) == 0 {
+		return nil, false, nil
+	}
+
+	cert := creds.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, false, fmt.Errorf("%w: client certificate has no common name", ErrUnauthenticated)
+	}
+
+	return &Subject{
+		Name:   cert.Subject.CommonName,
+		Groups: cert.Subject.Organization,
+		Method: MethodClientCert,
+	}, true, nil
+}
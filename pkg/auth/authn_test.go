@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newReviewer takes in the tokens the API server authenticates and returns
+// a TokenReview authenticator backed by a fake clientset and a pointer to
+// the number of reviews made
+func newReviewer(tokens map[string]string) (*tokenReviewAuthenticator, *int) {
+	reviews := 0
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if username, ok := tokens[review.Spec.Token]; ok {
+			review.Status = authnv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authnv1.UserInfo{Username: username, Groups: []string{"system:serviceaccounts"}},
+			}
+		}
+
+		return true, review, nil
+	})
+
+	return newTokenReviewAuthenticator(clientset, nil), &reviews
+}
+
+func TestTokenReviewAuthenticate(t *testing.T) {
+	a, _ := newReviewer(map[string]string{"sa-token": "system:serviceaccount:default:ci"})
+
+	subject, ok, err := a.Authenticate(context.Background(), Credentials{Authorization: "Bearer sa-token"})
+	if err != nil || !ok {
+		t.Fatalf("Authenticate() = %v, %v, want the subject", ok, err)
+	}
+	if subject.Name != "system:serviceaccount:default:ci" || subject.Method != MethodTokenReview {
+		t.Errorf("Authenticate() = %+v, want the ServiceAccount", subject)
+	}
+
+	if _, ok, err := a.Authenticate(context.Background(), Credentials{Authorization: "Bearer forged"}); err != nil || ok {
+		t.Errorf("Authenticate() = %v, %v, want the token not to be recognised", ok, err)
+	}
+
+	if _, ok, err := a.Authenticate(context.Background(), Credentials{}); err != nil || ok {
+		t.Errorf("Authenticate() = %v, %v, want no token not to be recognised", ok, err)
+	}
+}
+
+func TestTokenReviewCache(t *testing.T) {
+	a, reviews := newReviewer(map[string]string{"sa-token": "system:serviceaccount:default:ci"})
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	authenticate := func(token string) {
+		t.Helper()
+		if _, _, err := a.Authenticate(context.Background(), Credentials{Authorization: "Bearer " + token}); err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+	}
+
+	authenticate("sa-token")
+	authenticate("sa-token")
+	if *reviews != 1 {
+		t.Errorf("reviews = %d after a cached token, want 1", *reviews)
+	}
+
+	// The rejected tokens are cached as well
+	authenticate("forged")
+	authenticate("forged")
+	if *reviews != 2 {
+		t.Errorf("reviews = %d after a cached rejected token, want 2", *reviews)
+	}
+
+	now = now.Add(tokenReviewTTL - time.Second)
+	authenticate("sa-token")
+	if *reviews != 2 {
+		t.Errorf("reviews = %d before the review expired, want 2", *reviews)
+	}
+
+	now = now.Add(2 * time.Second)
+	authenticate("sa-token")
+	if *reviews != 3 {
+		t.Errorf("reviews = %d after the review expired, want 3", *reviews)
+	}
+
+	// Storing a review evicts the expired ones
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.cache) != 1 {
+		t.Errorf("cache has %d reviews, want the expired rejected token evicted", len(a.cache))
+	}
+}
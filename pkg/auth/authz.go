@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// VerbApply is the verb of the Apply requests
+	VerbApply = "apply"
+	// VerbDelete is the verb of the Delete requests
+	VerbDelete = "delete"
+)
+
+// Rule allows the matching subjects to perform the matching verbs on the
+// matching modules, empty fields match everything
+type Rule struct {
+	// Subjects are the names of the subjects, "group:<name>" for the
+	// members of a group or "*" for every subject
+	Subjects []string `json:"subjects"`
+	// Verbs are "apply" and "delete" or "*" for both
+	Verbs []string `json:"verbs"`
+	// Modules are the names of the modules
+	Modules []string `json:"modules"`
+	// ModuleSelector is a label selector of the module labels
+	ModuleSelector string `json:"moduleSelector"`
+
+	selector labels.Selector
+}
+
+// compile validates the rule and prepares it to be evaluated
+func (r *Rule) compile() error {
+	for _, verb := range r.Verbs {
+		if verb != VerbApply && verb != VerbDelete && verb != "*" {
+			return fmt.Errorf("invalid verb %q", verb)
+		}
+	}
+
+	if r.ModuleSelector == "" {
+		return nil
+	}
+
+	selector, err := labels.Parse(r.ModuleSelector)
+	if err != nil {
+		return fmt.Errorf("invalid module selector: %w", err)
+	}
+
+	r.selector = selector
+	return nil
+}
+
+// allows takes in a subject, a verb, the name of a module and its labels
+// and returns true if the rule allows the request
+//
+// A rule with a module selector never matches a module whose labels are
+// unknown, ie. nil
+func (r *Rule) allows(subject *Subject, verb, module string, moduleLabels map[string]string) bool {
+	if len(r.Subjects) > 0 && !anyOf(r.Subjects, subject.matches) {
+		return false
+	}
+
+	if len(r.Verbs) > 0 && !anyOf(r.Verbs, func(v string) bool { return v == "*" || v == verb }) {
+		return false
+	}
+
+	if len(r.Modules) > 0 && !anyOf(r.Modules, func(m string) bool { return m == module }) {
+		return false
+	}
+
+	if r.selector != nil && (moduleLabels == nil || !r.selector.Matches(labels.Set(moduleLabels))) {
+		return false
+	}
+
+	return true
+}
+
+// matches takes in a subject of a rule and returns true if it matches
+// the subject
+func (s *Subject) matches(name string) bool {
+	if name == "*" {
+		return true
+	}
+
+	if group := strings.TrimPrefix(name, "group:"); group != name {
+		for _, g := range s.Groups {
+			if g == group {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return name == s.Name
+}
+
+func anyOf(items []string, fn func(string) bool) bool {
+	for _, item := range items {
+		if fn(item) {
+			return true
+		}
+	}
+
+	return false
+}
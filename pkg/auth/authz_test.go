@@ -0,0 +1,164 @@
+package auth
+
+import "testing"
+
+func TestRuleAllows(t *testing.T) {
+	alice := &Subject{Name: "alice", Groups: []string{"netops"}}
+	netopsLabels := map[string]string{"team": "netops"}
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		verb   string
+		module string
+		labels map[string]string
+		want   bool
+	}{
+		{
+			name: "empty rule",
+			rule: Rule{},
+			verb: VerbApply, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "subject matches",
+			rule: Rule{Subjects: []string{"bob", "alice"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "subject does not match",
+			rule: Rule{Subjects: []string{"bob"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "wildcard subject",
+			rule: Rule{Subjects: []string{"*"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "group matches",
+			rule: Rule{Subjects: []string{"group:netops"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "group does not match",
+			rule: Rule{Subjects: []string{"group:admins"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "group is not a subject name",
+			rule: Rule{Subjects: []string{"netops"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "verb matches",
+			rule: Rule{Verbs: []string{VerbDelete}},
+			verb: VerbDelete, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "verb does not match",
+			rule: Rule{Verbs: []string{VerbApply}},
+			verb: VerbDelete, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "wildcard verb",
+			rule: Rule{Verbs: []string{"*"}},
+			verb: VerbDelete, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "module matches",
+			rule: Rule{Modules: []string{"tcp-rtt"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: true,
+		},
+		{
+			name: "module does not match",
+			rule: Rule{Modules: []string{"dns-latency"}},
+			verb: VerbApply, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "module selector matches",
+			rule: Rule{ModuleSelector: "team=netops"},
+			verb: VerbApply, module: "tcp-rtt", labels: netopsLabels,
+			want: true,
+		},
+		{
+			name: "module selector does not match",
+			rule: Rule{ModuleSelector: "team=storage"},
+			verb: VerbApply, module: "tcp-rtt", labels: netopsLabels,
+			want: false,
+		},
+		{
+			name: "module selector with unknown labels",
+			rule: Rule{ModuleSelector: "team=netops"},
+			verb: VerbDelete, module: "tcp-rtt",
+			want: false,
+		},
+		{
+			name: "every field matches",
+			rule: Rule{
+				Subjects:       []string{"group:netops"},
+				Verbs:          []string{VerbApply},
+				Modules:        []string{"tcp-rtt"},
+				ModuleSelector: "team in (netops, sre)",
+			},
+			verb: VerbApply, module: "tcp-rtt", labels: netopsLabels,
+			want: true,
+		},
+		{
+			name: "one field does not match",
+			rule: Rule{
+				Subjects:       []string{"group:netops"},
+				Verbs:          []string{VerbApply},
+				Modules:        []string{"tcp-rtt"},
+				ModuleSelector: "team in (netops, sre)",
+			},
+			verb: VerbDelete, module: "tcp-rtt", labels: netopsLabels,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			if err := rule.compile(); err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+
+			if got := rule.allows(alice, tt.verb, tt.module, tt.labels); got != tt.want {
+				t.Errorf("allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "valid verbs", rule: Rule{Verbs: []string{VerbApply, VerbDelete, "*"}}},
+		{name: "invalid verb", rule: Rule{Verbs: []string{"get"}}, wantErr: true},
+		{name: "valid selector", rule: Rule{ModuleSelector: "team=netops,!deprecated"}},
+		{name: "invalid selector", rule: Rule{ModuleSelector: "team in (netops"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.compile(); (err != nil) != tt.wantErr {
+				t.Errorf("compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the authentication and authorization configuration of the
+// REST API, it is loaded from a YAML or JSON file, eg.
+//
+//	authentication:
+//	  tokens:
+//	  - token: s3cr3t
+//	    subject: alice
+//	    groups: ["netops"]
+//	  tokenReview:
+//	    enabled: true
+//	  clientCert:
+//	    enabled: true
+//	authorization:
+//	  rules:
+//	  - subjects: ["group:netops"]
+//	    verbs: ["apply", "delete"]
+//	    moduleSelector: team=netops
+type Config struct {
+	Authentication AuthenticationConfig `json:"authentication"`
+	Authorization  AuthorizationConfig  `json:"authorization"`
+}
+
+// AuthenticationConfig configures the ways the clients can authenticate,
+// they are tried in order: client certificate, static tokens and then
+// TokenReview
+type AuthenticationConfig struct {
+	// Anonymous allows the requests without credentials, they are made as
+	// the "system:anonymous" subject
+	Anonymous bool `json:"anonymous"`
+
+	// Tokens are the static bearer tokens
+	Tokens []TokenConfig `json:"tokens"`
+
+	TokenReview TokenReviewConfig `json:"tokenReview"`
+	ClientCert  ClientCertConfig  `json:"clientCert"`
+}
+
+// TokenConfig is a static bearer token and the subject it authenticates
+type TokenConfig struct {
+	Token   string   `json:"token"`
+	Subject string   `json:"subject"`
+	Groups  []string `json:"groups"`
+}
+
+// TokenReviewConfig configures the authentication of the bearer tokens,
+// eg. ServiceAccount tokens, through the Kubernetes TokenReview API
+type TokenReviewConfig struct {
+	Enabled bool `json:"enabled"`
+	// Audiences are the audiences the tokens must be issued for, empty
+	// means the audiences of the API server
+	Audiences []string `json:"audiences"`
+}
+
+// ClientCertConfig configures the authentication of the TLS client
+// certificates, the common name is the subject and the organizations are
+// the groups
+//
+// It requires the REST server to serve TLS and to verify the client
+// certificates
+type ClientCertConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// AuthorizationConfig configures who can mutate the modules, the read-only
+// routes are allowed to every authenticated subject
+//
+// A mutation is allowed if any rule allows it, if there are no rules then
+// every mutation is allowed
+type AuthorizationConfig struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadConfig takes in the path of a YAML or JSON file and returns the
+// configuration in it
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %w", path, err)
+	}
+
+	for i, token := range cfg.Authentication.Tokens {
+		if token.Token == "" || token.Subject == "" {
+			return nil, fmt.Errorf("invalid auth config %s: token %d must have a token and a subject", path, i)
+		}
+	}
+
+	for i := range cfg.Authorization.Rules {
+		if err := cfg.Authorization.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid auth config %s: rule %d: %w", path, i, err)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,207 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Files are the PEM encoded files of a TLS configuration, every file is
+// optional
+type Files struct {
+	// Cert and Key are the certificate chain and the private key presented
+	// to the peer
+	Cert string
+	Key  string
+	// CA is the bundle of the certificate authorities the peer is verified
+	// against
+	CA string
+}
+
+// Empty returns true if none of the files is set
+func (f Files) Empty() bool {
+	return f.Cert == "" && f.Key == "" && f.CA == ""
+}
+
+// Validate returns an error if only one of the certificate and the key is
+// set
+func (f Files) Validate() error {
+	if (f.Cert == "") != (f.Key == "") {
+		return errors.New("both the certificate and the key files are required")
+	}
+
+	return nil
+}
+
+// Reloader keeps the certificate and the CA bundle loaded from the files
+// and reloads them when the files change, eg. when cert-manager rotates a
+// mounted secret
+//
+// A failed reload is logged and the previously loaded files are kept
+type Reloader struct {
+	files    Files
+	interval time.Duration
+
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+
+	lock sync.RWMutex
+}
+
+// NewReloader takes in the files and the interval at which they are
+// checked for changes and returns a new Reloader with the files loaded
+func NewReloader(files Files, interval time.Duration) (*Reloader, error) {
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{
+		files:    files,
+		interval: interval,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Start checks the files for changes every interval until the stop channel
+// is closed
+func (r *Reloader) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+
+				if err := r.reload(); err != nil {
+					logrus.Warnf("failed to reload TLS files, keeping the loaded ones: %s", err)
+					continue
+				}
+
+				logrus.Infof("Reloaded TLS files %s", r.files.names())
+			}
+		}
+	}()
+}
+
+// Certificate returns the loaded certificate, it is nil if no certificate
+// is configured
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.cert
+}
+
+// CAs returns the loaded CA bundle, it is nil if no CA is configured in
+// which case the system roots should be used
+func (r *Reloader) CAs() *x509.CertPool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.pool
+}
+
+// changed returns true if any of the files was modified since the last
+// reload
+func (r *Reloader) changed() bool {
+	modTime, err := r.files.modTime()
+	if err != nil {
+		logrus.Warnf("failed to stat TLS files: %s", err)
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return !modTime.Equal(r.modTime)
+}
+
+// reload loads the files and replaces the loaded ones
+func (r *Reloader) reload() error {
+	// The modification time is read first so that a change made while
+	// loading triggers another reload
+	modTime, err := r.files.modTime()
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if r.files.Cert != "" {
+		loaded, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+		if err != nil {
+			return fmt.Errorf("failed to load key pair %s: %w", r.files.Cert, err)
+		}
+
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+	if r.files.CA != "" {
+		data, err := os.ReadFile(r.files.CA)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", r.files.CA)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cert = cert
+	r.pool = pool
+	r.modTime = modTime
+	return nil
+}
+
+// modTime returns the latest modification time of the files
+func (f Files) modTime() (latest time.Time, err error) {
+	for _, name := range []string{f.Cert, f.Key, f.CA} {
+		if name == "" {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (f Files) names() []string {
+	names := []string{}
+	for _, name := range []string{f.Cert, f.Key, f.CA} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
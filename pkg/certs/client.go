@@ -0,0 +1,126 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+)
+
+// defaultServerName is the server name the daemon certificates are
+// verified against, ie. the daemon certificates are issued per node
+const defaultServerName = "{node}"
+
+// ClientConfig is the TLS configuration of the connections to the hyperion
+// daemons
+type ClientConfig struct {
+	Files Files
+	// ServerName is the template of the name the certificate of a daemon
+	// is verified against, it may contain the {pod}, {namespace}, {node}
+	// and {ip} placeholders which are replaced by the identity of the
+	// daemon pod
+	ServerName string
+}
+
+// ClientConfigFromEnv reads the TLS configuration of the connections to
+// the daemons from the environmental variables, TLS is disabled if the
+// returned files are empty
+//
+//   - K8TRICS_DAEMON_TLS_CA_FILE: CA bundle the daemon certificates are
+//     verified against, the system roots are used if it is not set
+//   - K8TRICS_DAEMON_TLS_CERT_FILE and K8TRICS_DAEMON_TLS_KEY_FILE: client
+//     certificate presented to the daemons for mTLS
+//   - K8TRICS_DAEMON_TLS_SERVER_NAME: template of the daemon server name,
+//     defaults to "{node}"
+func ClientConfigFromEnv() (ClientConfig, error) {
+	cfg := ClientConfig{
+		Files: Files{
+			Cert: utils.GetEnv("K8TRICS_DAEMON_TLS_CERT_FILE", ""),
+			Key:  utils.GetEnv("K8TRICS_DAEMON_TLS_KEY_FILE", ""),
+			CA:   utils.GetEnv("K8TRICS_DAEMON_TLS_CA_FILE", ""),
+		},
+		ServerName: utils.GetEnv("K8TRICS_DAEMON_TLS_SERVER_NAME", defaultServerName),
+	}
+
+	return cfg, cfg.Files.Validate()
+}
+
+// Client creates the TLS configurations of the connections to the daemons
+type Client struct {
+	cfg      ClientConfig
+	reloader *Reloader
+}
+
+// NewClient takes in the client configuration and the reloader of its
+// files and returns a new instance of Client
+func NewClient(cfg ClientConfig, reloader *Reloader) *Client {
+	return &Client{
+		cfg:      cfg,
+		reloader: reloader,
+	}
+}
+
+// ServerName takes in a daemon pod and returns the name its certificate
+// must be valid for
+func (c *Client) ServerName(pod store.K8tricsPod) string {
+	return strings.NewReplacer(
+		"{pod}", pod.GetName(),
+		"{namespace}", pod.GetNamespace(),
+		"{node}", pod.Spec.NodeName,
+		"{ip}", pod.Status.PodIP,
+	).Replace(c.cfg.ServerName)
+}
+
+// TLSConfig takes in the server name of a daemon and returns the TLS
+// configuration of a connection to it
+//
+// The verification is done by hand against the currently loaded CA bundle
+// rather than through RootCAs so that the long lived connections pick up
+// a rotated CA when they reconnect
+func (c *Client) TLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		// The certificate is verified by VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return c.verify(serverName, state)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := c.reloader.Certificate(); cert != nil {
+				return cert, nil
+			}
+
+			// No certificate is sent if there is none configured
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// verify takes in the expected server name and the state of a handshake
+// and verifies the certificate chain presented by the daemon
+func (c *Client) verify(serverName string, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("daemon presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if serverName == "" {
+		return errors.New("daemon server name is empty")
+	}
+
+	// An IP server name is matched against the IP SANs by Verify
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         c.reloader.CAs(),
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
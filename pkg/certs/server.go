@@ -0,0 +1,127 @@
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+)
+
+// ClientAuth decides whether the server asks the clients for certificates
+type ClientAuth string
+
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthRequest verifies the client certificates if they are
+	// presented, the clients without one can still authenticate otherwise,
+	// eg. with a bearer token
+	ClientAuthRequest ClientAuth = "request"
+	// ClientAuthRequire rejects the clients without a verified certificate
+	ClientAuthRequire ClientAuth = "require"
+)
+
+// ParseClientAuth takes in the name of a client auth mode and returns the
+// mode
+func ParseClientAuth(name string) (ClientAuth, error) {
+	switch mode := ClientAuth(name); mode {
+	case ClientAuthNone, ClientAuthRequest, ClientAuthRequire:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid client auth %q", name)
+	}
+}
+
+// ServerConfig is the TLS configuration of a server
+type ServerConfig struct {
+	Files      Files
+	ClientAuth ClientAuth
+}
+
+// ServerConfigFromEnv reads the TLS configuration of the REST and the gRPC
+// servers from the environmental variables, TLS is disabled if the
+// returned files are empty
+//
+//   - K8TRICS_TLS_CERT_FILE and K8TRICS_TLS_KEY_FILE: serving certificate
+//   - K8TRICS_TLS_CA_FILE: CA bundle the client certificates are verified
+//     against
+//   - K8TRICS_TLS_CLIENT_AUTH: none, request or require, defaults to
+//     request if the CA bundle is set
+func ServerConfigFromEnv() (ServerConfig, error) {
+	cfg := ServerConfig{
+		Files: Files{
+			Cert: utils.GetEnv("K8TRICS_TLS_CERT_FILE", ""),
+			Key:  utils.GetEnv("K8TRICS_TLS_KEY_FILE", ""),
+			CA:   utils.GetEnv("K8TRICS_TLS_CA_FILE", ""),
+		},
+		ClientAuth: ClientAuthNone,
+	}
+
+	if cfg.Files.CA != "" {
+		cfg.ClientAuth = ClientAuthRequest
+	}
+
+	if raw := utils.GetEnv("K8TRICS_TLS_CLIENT_AUTH", ""); raw != "" {
+		mode, err := ParseClientAuth(raw)
+		if err != nil {
+			return cfg, err
+		}
+
+		cfg.ClientAuth = mode
+	}
+
+	if cfg.Files.Empty() {
+		return cfg, nil
+	}
+
+	if cfg.Files.Cert == "" {
+		return cfg, errors.New("K8TRICS_TLS_CERT_FILE and K8TRICS_TLS_KEY_FILE are required to serve TLS")
+	}
+
+	if cfg.ClientAuth != ClientAuthNone && cfg.Files.CA == "" {
+		return cfg, errors.New("K8TRICS_TLS_CA_FILE is required to verify the client certificates")
+	}
+
+	return cfg, cfg.Files.Validate()
+}
+
+// TLSConfig takes in the reloader of the files and the application
+// protocols negotiated through ALPN, eg. "h2" for gRPC, and returns the TLS
+// configuration of the server, every handshake uses the currently loaded
+// certificate and CA bundle
+func (c ServerConfig) TLSConfig(reloader *Reloader, nextProtos ...string) *tls.Config {
+	clientAuth := tls.NoClientCert
+	switch c.ClientAuth {
+	case ClientAuthRequest:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert := reloader.Certificate()
+		if cert == nil {
+			return nil, errors.New("no serving certificate loaded")
+		}
+
+		return cert, nil
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		// GetCertificate is unused as GetConfigForClient takes precedence,
+		// it marks the configuration as having a certificate for net/http
+		GetCertificate: getCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     nextProtos,
+				GetCertificate: getCertificate,
+				ClientAuth:     clientAuth,
+				ClientCAs:      reloader.CAs(),
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,478 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/exporter"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/k8s"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/rollout"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/tracker"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// resyncPeriod is the interval at which every module is reconciled
+	// again, it catches the daemons whose endpoint was resolved late
+	resyncPeriod = 30 * time.Second
+
+	// requestTimeout bounds the Apply and Delete requests of a reconcile
+	requestTimeout = 30 * time.Second
+)
+
+// Controller reconciles the HyperionModule custom resources by applying
+// the declared modules on every hyperion daemon and deleting them once
+// the resource is deleted
+//
+// The state of the module on every node is reported in the status of the
+// resource, the daemons which do not run the current generation of the
+// module, eg. the new or restarted ones, are applied again
+type Controller struct {
+	clientset kubernetes.Interface
+	client    dynamic.ResourceInterface
+	factory   dynamicinformer.DynamicSharedInformerFactory
+	informer  cache.SharedIndexInformer
+	queue     workqueue.RateLimitingInterface
+
+	discovery *discovery.Discovery
+	fanout    *fanout.Fanout
+	exporter  *exporter.Exporter
+	verifier  *release.Verifier
+}
+
+// New returns a new instance of the controller, it must be called before
+// the tracker is started as it watches the daemon pods becoming ready
+func New(khandler *k8s.K8s, tracker *tracker.Tracker, discovery *discovery.Discovery, fanout *fanout.Fanout, exporter *exporter.Exporter, verifier *release.Verifier) *Controller {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(khandler.Dynamic(), resyncPeriod)
+
+	c := &Controller{
+		clientset: khandler.ClientSet(),
+		client:    khandler.Dynamic().Resource(HyperionModuleResource),
+		factory:   factory,
+		informer:  factory.ForResource(HyperionModuleResource).Informer(),
+		queue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "hyperionmodules"),
+		discovery: discovery,
+		fanout:    fanout,
+		exporter:  exporter,
+		verifier:  verifier,
+	}
+
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: c.enqueue,
+	})
+
+	tracker.OnPodReady(c.handlePodReady)
+
+	return c
+}
+
+// Run starts the controller and blocks until the context is cancelled
+//
+// If the HyperionModule custom resource definition is not installed in
+// the cluster then the controller is disabled and Run returns immediately
+func (c *Controller) Run(ctx context.Context) error {
+	if !c.installed() {
+		logrus.Warnf("%s is not installed, the module controller is disabled", HyperionModuleResource.GroupResource())
+		return nil
+	}
+
+	defer c.queue.ShutDown()
+
+	c.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return errors.New("failed to sync the HyperionModule informer cache")
+	}
+
+	logrus.Infoln("Started the module controller")
+	go wait.UntilWithContext(ctx, c.worker, time.Second)
+
+	<-ctx.Done()
+	return nil
+}
+
+// installed returns true if the custom resource definition is served by
+// the API server
+func (c *Controller) installed() bool {
+	gv := HyperionModuleResource.GroupVersion().String()
+
+	resources, err := c.clientset.Discovery().ServerResourcesForGroupVersion(gv)
+	if err != nil {
+		return false
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == HyperionModuleResource.Resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		logrus.Warn("failed to get key of HyperionModule: ", err)
+		return
+	}
+
+	c.queue.Add(key)
+}
+
+// handlePodReady enqueues every module when a daemon becomes ready so that
+// the modules are applied on it
+func (c *Controller) handlePodReady(pod store.K8tricsPod) {
+	if !c.informer.HasSynced() {
+		return
+	}
+
+	for _, daemon := range c.discovery.Daemons() {
+		if daemon.Pod.GetName() != pod.GetName() || daemon.Pod.GetNamespace() != pod.GetNamespace() {
+			continue
+		}
+
+		for _, obj := range c.informer.GetStore().List() {
+			c.enqueue(obj)
+		}
+
+		return
+	}
+}
+
+func (c *Controller) worker(ctx context.Context) {
+	for c.processNext(ctx) {
+	}
+}
+
+func (c *Controller) processNext(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.reconcile(ctx, key.(string)); err != nil {
+		logrus.Warnf("failed to reconcile HyperionModule %s: %s", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile takes in the key of a resource and drives the daemons towards
+// the state declared by it
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	obj, exists, err := c.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return err
+	}
+
+	// The finalizer has already cleaned up the daemons
+	if !exists {
+		return nil
+	}
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected object of type %T", obj)
+	}
+
+	module, err := fromUnstructured(u.UnstructuredContent())
+	if err != nil {
+		// Retrying will not fix an invalid resource
+		logrus.Warnf("invalid HyperionModule %s: %s", key, err)
+		return nil
+	}
+
+	if module.GetDeletionTimestamp() != nil {
+		return c.finalize(ctx, u, module)
+	}
+
+	if !hasFinalizer(u) {
+		u = u.DeepCopy()
+		u.SetFinalizers(append(u.GetFinalizers(), Finalizer))
+
+		// The update triggers another reconcile
+		_, err := c.client.Update(ctx, u, metav1.UpdateOptions{})
+		return err
+	}
+
+	return c.apply(ctx, u, module)
+}
+
+// apply applies the module on the daemons which do not run its current
+// generation and records the state of every daemon in the status
+func (c *Controller) apply(ctx context.Context, u *unstructured.Unstructured, module *HyperionModule) error {
+	name := module.ModuleName()
+	generation := module.GetGeneration()
+
+	// The module was renamed, the old one must not keep running
+	if old := module.Status.ModuleName; old != "" && old != name {
+		if err := c.delete(ctx, old); err != nil {
+			return err
+		}
+
+		module.Status.Nodes = nil
+	}
+
+	previous := map[string]NodeStatus{}
+	for _, node := range module.Status.Nodes {
+		previous[node.Node] = node
+	}
+
+	daemons := c.discovery.Daemons()
+
+	// The daemons which run the current generation, or which cannot run
+	// it for a terminal reason, are left alone. A daemon which restarted
+	// since the module was applied lost it even though its pod is the same
+	pending := []discovery.Daemon{}
+	for _, daemon := range daemons {
+		prev, ok := previous[daemon.Pod.Spec.NodeName]
+		settled := (prev.Applied && prev.Restarts == restarts(daemon.Pod)) || prev.Reason != ""
+		if daemon.Err != nil || (ok && settled && prev.Pod == daemon.Pod.GetName() && prev.ObservedGeneration == generation) {
+			continue
+		}
+
+		pending = append(pending, daemon)
+	}
+
+	results := map[string]fanout.DaemonResult{}
+	unsupported := map[string]string{}
+	if len(pending) > 0 {
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+
+		req := api.ApplyRequest{Module: module.Module()}
+
+		// The nodes without a release for their architecture cannot be
+		// fixed by retrying, unlike the nodes whose architecture could not
+		// be looked up
+		plan := rollout.New(c.discovery, req.Module, pending)
+		for _, u := range plan.Unsupported {
+			node := u.Daemon.Pod.Spec.NodeName
+			if u.Platform == "" {
+				results[node] = fanout.DaemonResult{Node: node, Error: u.Err.Error()}
+				continue
+			}
+
+			unsupported[node] = u.Err.Error()
+		}
+
+		if len(plan.Targets) > 0 {
+			// A module failing the verification is reported on every
+			// target without contacting the daemons
+			if err := c.verifier.Verify(reqCtx, req.Module); err != nil {
+				for _, daemon := range plan.Targets {
+					node := daemon.Pod.Spec.NodeName
+					results[node] = fanout.DaemonResult{Node: node, Error: err.Error()}
+				}
+			} else {
+				resp := c.fanout.RequestDaemons(plan.Targets, func(conn *grpc.ClientConn) (interface{}, error) {
+					return rpc.HyperionApply(reqCtx, &req, conn)
+				})
+
+				for _, result := range resp.Results {
+					results[result.Node] = result
+				}
+			}
+		}
+	}
+
+	status := HyperionModuleStatus{
+		ObservedGeneration: generation,
+		ModuleName:         name,
+	}
+
+	now := metav1.Now()
+	applied, failed := 0, 0
+
+	for _, daemon := range daemons {
+		nodeName := daemon.Pod.Spec.NodeName
+		prev, ok := previous[nodeName]
+
+		node := prev
+		if msg, ok := unsupported[nodeName]; ok {
+			node = NodeStatus{
+				Pod:                daemon.Pod.GetName(),
+				ObservedGeneration: generation,
+				Reason:             ReasonUnsupportedArch,
+				Message:            msg,
+			}
+		} else if result, applying := results[nodeName]; applying {
+			node = NodeStatus{Pod: daemon.Pod.GetName(), Applied: result.Error == "", Message: result.Error}
+			if node.Applied {
+				node.ObservedGeneration = generation
+				node.Restarts = restarts(daemon.Pod)
+			} else {
+				failed++
+			}
+		} else if daemon.Err != nil {
+			node = NodeStatus{Pod: daemon.Pod.GetName(), Message: daemon.Err.Error()}
+		}
+		node.Node, node.Pod = nodeName, daemon.Pod.GetName()
+
+		node.LastTransitionTime = prev.LastTransitionTime
+		if !ok || prev.Applied != node.Applied {
+			node.LastTransitionTime = now
+		}
+
+		if node.Applied {
+			applied++
+		}
+
+		status.Nodes = append(status.Nodes, node)
+	}
+
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Node < status.Nodes[j].Node
+	})
+
+	switch {
+	case applied == 0:
+		status.Phase = PhasePending
+	case applied == len(status.Nodes):
+		status.Phase = PhaseApplied
+	default:
+		status.Phase = PhasePartiallyApplied
+	}
+
+	if applied > 0 {
+		c.exporter.Subscribe(name)
+	}
+
+	if err := c.updateStatus(ctx, u, module.Status, status); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to apply module %s on %d daemons", name, failed)
+	}
+
+	return nil
+}
+
+// finalize deletes the module from the daemons and removes the finalizer
+// so that the resource can go away
+func (c *Controller) finalize(ctx context.Context, u *unstructured.Unstructured, module *HyperionModule) error {
+	if !hasFinalizer(u) {
+		return nil
+	}
+
+	name := module.Status.ModuleName
+	if name == "" {
+		name = module.ModuleName()
+	}
+
+	if err := c.delete(ctx, name); err != nil {
+		return err
+	}
+
+	c.exporter.Unsubscribe(name)
+
+	u = u.DeepCopy()
+	finalizers := []string{}
+	for _, finalizer := range u.GetFinalizers() {
+		if finalizer != Finalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	u.SetFinalizers(finalizers)
+
+	_, err := c.client.Update(ctx, u, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// delete takes in the name of a module and deletes it from every daemon
+//
+// The daemons which cannot be contacted are skipped as a restarted daemon
+// does not run any module, as are the ones which do not run the module
+func (c *Controller) delete(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req := api.DeleteRequest{Core: &base.ModuleCore{Name: name}}
+	resp := c.fanout.Request(discovery.NodeFilter{}, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionDelete(ctx, &req, conn)
+	})
+
+	for _, result := range resp.Results {
+		switch result.Code {
+		case codes.OK.String(), codes.NotFound.String(), codes.Unavailable.String():
+		default:
+			return fmt.Errorf("failed to delete module %s from node %s: %s", name, result.Node, result.Error)
+		}
+	}
+
+	return nil
+}
+
+// updateStatus takes in the current and the new status of the resource
+// and writes the new status if it has changed
+func (c *Controller) updateStatus(ctx context.Context, u *unstructured.Unstructured, current, status HyperionModuleStatus) error {
+	if equality.Semantic.DeepEqual(current, status) {
+		return nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+
+	u = u.DeepCopy()
+	u.Object["status"] = content
+
+	_, err = c.client.UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	return err
+}
+
+// restarts takes in a daemon pod and returns the number of times its
+// containers have restarted
+func restarts(pod store.K8tricsPod) int32 {
+	count := int32(0)
+	for _, cs := range pod.Status.ContainerStatuses {
+		count += cs.RestartCount
+	}
+
+	return count
+}
+
+func hasFinalizer(u *unstructured.Unstructured) bool {
+	for _, finalizer := range u.GetFinalizers() {
+		if finalizer == Finalizer {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HyperionModuleResource is the cluster scoped custom resource which
+// declares a module that must be running on every hyperion daemon
+var HyperionModuleResource = schema.GroupVersionResource{
+	Group:    "hyperion.io",
+	Version:  "v1alpha1",
+	Resource: "hyperionmodules",
+}
+
+const (
+	// Finalizer makes sure that the module is deleted from the daemons
+	// before the custom resource goes away
+	Finalizer = "hyperion.io/module-cleanup"
+
+	// PhaseApplied means that the module is running on every daemon
+	PhaseApplied = "Applied"
+	// PhasePartiallyApplied means that the module is running only on some
+	// of the daemons
+	PhasePartiallyApplied = "PartiallyApplied"
+	// PhasePending means that the module is not running on any daemon
+	PhasePending = "Pending"
+
+	// ReasonUnsupportedArch means that the module has no release for the
+	// architecture of the node, it is not retried until the spec changes
+	ReasonUnsupportedArch = "UnsupportedArch"
+)
+
+// HyperionModule is the custom resource representation of a module
+type HyperionModule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HyperionModuleSpec   `json:"spec"`
+	Status HyperionModuleStatus `json:"status,omitempty"`
+}
+
+// HyperionModuleSpec mirrors base.Module, hence the body of an Apply
+// request can be used as is
+type HyperionModuleSpec struct {
+	Core     ModuleCore     `json:"core,omitempty"`
+	Metadata ModuleMetadata `json:"metadata,omitempty"`
+	Spec     ModuleSpec     `json:"spec,omitempty"`
+}
+
+// ModuleCore mirrors base.ModuleCore
+type ModuleCore struct {
+	// Name is the name of the module, it defaults to the name of the
+	// custom resource
+	Name string `json:"name,omitempty"`
+}
+
+// ModuleMetadata mirrors base.ModuleMetadata
+type ModuleMetadata struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Release ModuleReleases    `json:"release,omitempty"`
+}
+
+// ModuleReleases mirrors base.ModuleMetadata_Releases
+type ModuleReleases struct {
+	LinuxAMD64 *ModuleRelease `json:"linuxAMD64,omitempty"`
+	LinuxARM64 *ModuleRelease `json:"linuxARM64,omitempty"`
+}
+
+// ModuleRelease mirrors base.ModuleMetadata_Releases_ModuleRelease
+type ModuleRelease struct {
+	Location string `json:"location,omitempty"`
+	Sha256   string `json:"sha256,omitempty"`
+}
+
+// ModuleSpec mirrors base.ModuleSpec
+type ModuleSpec struct {
+	Data       string      `json:"data,omitempty"`
+	DataSource *DataSource `json:"dataSource,omitempty"`
+}
+
+// DataSource mirrors base.ModuleSpec_DataSource
+type DataSource struct {
+	Label *LabelSelector `json:"label,omitempty"`
+}
+
+// LabelSelector mirrors base.LabelSelector
+type LabelSelector struct {
+	Selector map[string]string `json:"selector,omitempty"`
+}
+
+// HyperionModuleStatus is the observed state of the module on the daemons
+type HyperionModuleStatus struct {
+	// ObservedGeneration is the generation of the spec which was last
+	// reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Restarts is the number of container restarts of the daemon pod when
+	// the module was applied, a restarted daemon runs no module
+	Restarts int32 `json:"restarts,omitempty"`
+	// ModuleName is the name under which the module was applied
+	ModuleName string `json:"moduleName,omitempty"`
+	// Phase is one of Applied, PartiallyApplied or Pending
+	Phase string `json:"phase,omitempty"`
+	// Nodes is the state of the module on the daemon of every node
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+}
+
+// NodeStatus is the state of the module on the daemon of a node
+type NodeStatus struct {
+	Node string `json:"node"`
+	Pod  string `json:"pod"`
+	// Applied is true if the module is running on the daemon
+	Applied bool `json:"applied"`
+	// ObservedGeneration is the generation of the spec which is running on
+	// the daemon, or which cannot run on it for a terminal reason
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Restarts is the number of container restarts of the daemon pod when
+	// the module was applied, a restarted daemon runs no module
+	Restarts int32 `json:"restarts,omitempty"`
+	// Reason is set if the module cannot run on the daemon for a terminal
+	// reason, eg. UnsupportedArch
+	Reason string `json:"reason,omitempty"`
+	// Message is the reason the module is not running on the daemon
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ModuleName returns the name of the module declared by the resource
+func (m *HyperionModule) ModuleName() string {
+	if m.Spec.Core.Name != "" {
+		return m.Spec.Core.Name
+	}
+
+	return m.GetName()
+}
+
+// Module returns the module declared by the resource
+func (m *HyperionModule) Module() *base.Module {
+	spec := m.Spec
+
+	module := &base.Module{
+		Core: &base.ModuleCore{Name: m.ModuleName()},
+		Metadata: &base.ModuleMetadata{
+			Labels:  spec.Metadata.Labels,
+			Release: &base.ModuleMetadata_Releases{},
+		},
+		Spec: &base.ModuleSpec{Data: spec.Spec.Data},
+	}
+
+	if r := spec.Metadata.Release.LinuxAMD64; r != nil {
+		module.Metadata.Release.LinuxAMD64 = &base.ModuleMetadata_Releases_ModuleRelease{Location: r.Location, Sha256: r.Sha256}
+	}
+	if r := spec.Metadata.Release.LinuxARM64; r != nil {
+		module.Metadata.Release.LinuxARM64 = &base.ModuleMetadata_Releases_ModuleRelease{Location: r.Location, Sha256: r.Sha256}
+	}
+
+	if ds := spec.Spec.DataSource; ds != nil && ds.Label != nil {
+		module.Spec.DataSource = &base.ModuleSpec_DataSource{
+			Label: &base.LabelSelector{Selector: ds.Label.Selector},
+		}
+	}
+
+	return module
+}
+
+// fromUnstructured takes in the unstructured content of a custom resource
+// and returns the typed resource
+func fromUnstructured(obj map[string]interface{}) (*HyperionModule, error) {
+	module := &HyperionModule{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, module); err != nil {
+		return nil, err
+	}
+
+	return module, nil
+}
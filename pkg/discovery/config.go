@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// ModePod discovers the daemons by looking up the pods matching the
+	// label selector in the pod store
+	ModePod = "pod"
+
+	// ModeEndpointSlice discovers the daemons through the EndpointSlices
+	// of a Service
+	ModeEndpointSlice = "endpointslice"
+)
+
+// Config is the configuration used to discover the hyperion daemons
+type Config struct {
+	// Mode is the discovery mode, either ModePod or ModeEndpointSlice
+	Mode string
+	// Selector is the label selector of the daemon pods in the form of
+	// "key1=value1,key2=value2"
+	Selector string
+	// Namespace restricts the discovery to the given namespace, empty
+	// value means all of the namespaces
+	Namespace string
+	// PortName is the name of the container port, or the Service port in
+	// case of EndpointSlice discovery, serving the hyperion gRPC API. If
+	// empty then the first port is used
+	PortName string
+	// Service is the name of the Service backing the daemons in the form
+	// of "namespace/name", used only by the EndpointSlice discovery
+	Service string
+}
+
+// NewConfig returns the discovery configuration populated from the
+// environmental variables, falling back to the defaults
+func NewConfig() *Config {
+	return &Config{
+		Mode:      utils.GetEnv("K8TRICS_DISCOVERY_MODE", ModePod),
+		Selector:  utils.GetEnv("K8TRICS_DAEMON_SELECTOR", "core.hyperion.io/master=true"),
+		Namespace: utils.GetEnv("K8TRICS_DAEMON_NAMESPACE", ""),
+		PortName:  utils.GetEnv("K8TRICS_DAEMON_PORT_NAME", ""),
+		Service:   utils.GetEnv("K8TRICS_DAEMON_SERVICE", ""),
+	}
+}
+
+// BindFlags registers the configuration as flags on the given flag set,
+// the current values are used as the defaults so the flags take
+// precedence over the environmental variables
+func (cfg *Config) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Mode, "discovery-mode", cfg.Mode, "hyperion daemon discovery mode, one of \"pod\" or \"endpointslice\"")
+	fs.StringVar(&cfg.Selector, "daemon-selector", cfg.Selector, "label selector of the hyperion daemon pods")
+	fs.StringVar(&cfg.Namespace, "daemon-namespace", cfg.Namespace, "namespace of the hyperion daemons, empty for all namespaces")
+	fs.StringVar(&cfg.PortName, "daemon-port-name", cfg.PortName, "name of the port serving the hyperion gRPC API, empty for the first port")
+	fs.StringVar(&cfg.Service, "daemon-service", cfg.Service, "\"namespace/name\" of the hyperion daemon Service for endpointslice discovery")
+}
+
+// Validate checks the configuration and returns an error if it is invalid
+func (cfg *Config) Validate() error {
+	switch cfg.Mode {
+	case ModePod:
+		if _, err := cfg.selector(); err != nil {
+			return err
+		}
+	case ModeEndpointSlice:
+		if _, _, err := cfg.service(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid discovery mode %q", cfg.Mode)
+	}
+
+	return nil
+}
+
+// selector parses the label selector of the configuration
+func (cfg *Config) selector() (map[string]string, error) {
+	selector, err := labels.ConvertSelectorToLabelsMap(cfg.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid daemon selector %q: %w", cfg.Selector, err)
+	}
+
+	return selector, nil
+}
+
+// service parses the namespace and the name of the Service of the
+// configuration
+func (cfg *Config) service() (string, string, error) {
+	splitted := strings.Split(cfg.Service, "/")
+	if len(splitted) != 2 || splitted[0] == "" || splitted[1] == "" {
+		return "", "", errors.New("daemon service must be in the form of \"namespace/name\"")
+	}
+
+	return splitted[0], splitted[1], nil
+}
@@ -0,0 +1,301 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+)
+
+// Daemon is a hyperion daemon discovered in the cluster
+type Daemon struct {
+	Pod store.K8tricsPod
+
+	// Endpoint is the address of the gRPC server of the daemon, it is
+	// empty if the daemon cannot serve requests
+	Endpoint string
+	// Err is the reason the endpoint of the daemon could not be resolved
+	Err error
+}
+
+// Discovery finds the hyperion daemons in the cluster according to the
+// discovery configuration
+type Discovery struct {
+	cfg   *Config
+	store *store.PodStore
+
+	selector  map[string]string
+	namespace string
+	service   string
+
+	slices discoverylisters.EndpointSliceLister
+	nodes  corelisters.NodeLister
+}
+
+// NodeFilter restricts the daemons to the ones running on specific nodes
+//
+// An empty filter matches every daemon
+type NodeFilter struct {
+	// Names are the names of the nodes, empty means any node
+	Names []string
+	// Selector is the label selector of the nodes, nil means any node
+	Selector labels.Selector
+}
+
+// Empty returns true if the filter matches every daemon
+func (f NodeFilter) Empty() bool {
+	return len(f.Names) == 0 && (f.Selector == nil || f.Selector.Empty())
+}
+
+// ParseNodeFilter takes in a list of node names, each of which may be a
+// comma separated list, and a kubernetes label selector of the nodes and
+// returns the node filter
+func ParseNodeFilter(names []string, selector string) (NodeFilter, error) {
+	filter := NodeFilter{}
+
+	for _, param := range names {
+		for _, name := range strings.Split(param, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.Names = append(filter.Names, name)
+			}
+		}
+	}
+
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return filter, fmt.Errorf("invalid node selector: %w", err)
+		}
+
+		filter.Selector = parsed
+	}
+
+	return filter, nil
+}
+
+// New takes in the discovery configuration, the pod store and the shared
+// informer factory and returns a new instance of Discovery
+//
+// The Node informer and, in case of EndpointSlice discovery, the
+// EndpointSlice informer are registered on the factory, hence New must be
+// called before the factory is started
+func New(cfg *Config, store *store.PodStore, factory informers.SharedInformerFactory) (*Discovery, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := &Discovery{
+		cfg:       cfg,
+		store:     store,
+		namespace: cfg.Namespace,
+	}
+
+	// Calling Informer registers the informer with the factory
+	nodes := factory.Core().V1().Nodes()
+	nodes.Informer()
+	d.nodes = nodes.Lister()
+
+	switch cfg.Mode {
+	case ModePod:
+		d.selector, _ = cfg.selector()
+	case ModeEndpointSlice:
+		d.namespace, d.service, _ = cfg.service()
+
+		informer := factory.Discovery().V1().EndpointSlices()
+		informer.Informer()
+		d.slices = informer.Lister()
+	}
+
+	return d, nil
+}
+
+// Daemons returns all of the hyperion daemons which are currently known,
+// including the ones which are not ready to serve requests
+func (d *Discovery) Daemons() []Daemon {
+	if d.cfg.Mode == ModeEndpointSlice {
+		return d.fromEndpointSlices()
+	}
+
+	return d.fromPods()
+}
+
+// Ready returns only the daemons which are ready to serve requests
+func (d *Discovery) Ready() (ready []Daemon) {
+	for _, daemon := range d.Daemons() {
+		if daemon.Err == nil {
+			ready = append(ready, daemon)
+		}
+	}
+
+	return
+}
+
+// Candidate takes in a pod and returns true if the pod may be a daemon,
+// it is a cheap check which does not require the daemon to be resolved
+//
+// In EndpointSlice mode the pod is only known to be a daemon once it is
+// added to the EndpointSlices, hence every pod of the daemon namespace is
+// a candidate
+func (d *Discovery) Candidate(pod store.K8tricsPod) bool {
+	if d.namespace != "" && pod.GetNamespace() != d.namespace {
+		return false
+	}
+
+	if d.cfg.Mode == ModeEndpointSlice {
+		return true
+	}
+
+	return labels.SelectorFromSet(d.selector).Matches(labels.Set(pod.GetLabels()))
+}
+
+// Select takes in a node filter and returns the daemons, including the
+// ones which are not ready, running on the nodes matching the filter
+func (d *Discovery) Select(filter NodeFilter) (selected []Daemon) {
+	daemons := d.Daemons()
+	if filter.Empty() {
+		return daemons
+	}
+
+	names := map[string]struct{}{}
+	for _, name := range filter.Names {
+		names[name] = struct{}{}
+	}
+
+	for _, daemon := range daemons {
+		nodeName := daemon.Pod.Spec.NodeName
+
+		if len(names) > 0 {
+			if _, ok := names[nodeName]; !ok {
+				continue
+			}
+		}
+
+		if filter.Selector != nil && !filter.Selector.Empty() {
+			node, err := d.nodes.Get(nodeName)
+			if err != nil || !filter.Selector.Matches(labels.Set(node.GetLabels())) {
+				continue
+			}
+		}
+
+		selected = append(selected, daemon)
+	}
+
+	return
+}
+
+// Platform takes in the name of a node and returns its platform, eg.
+// "linux/amd64", built from the kubernetes.io/os and kubernetes.io/arch
+// labels of the node, the OS defaults to linux if it is not labelled
+func (d *Discovery) Platform(nodeName string) (string, error) {
+	node, err := d.nodes.Get(nodeName)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up node %s: %w", nodeName, err)
+	}
+
+	arch := node.GetLabels()[corev1.LabelArchStable]
+	if arch == "" {
+		return "", fmt.Errorf("node %s has no %s label", nodeName, corev1.LabelArchStable)
+	}
+
+	nodeOS := node.GetLabels()[corev1.LabelOSStable]
+	if nodeOS == "" {
+		nodeOS = "linux"
+	}
+
+	return nodeOS + "/" + arch, nil
+}
+
+// fromPods discovers the daemons by looking up the pods in the pod store
+func (d *Discovery) fromPods() (daemons []Daemon) {
+	for _, pod := range d.store.GetByLabels(d.selector) {
+		if d.namespace != "" && pod.GetNamespace() != d.namespace {
+			continue
+		}
+
+		endpoint, err := pod.NamedEndpoint(d.cfg.PortName)
+		daemons = append(daemons, Daemon{
+			Pod:      pod,
+			Endpoint: endpoint,
+			Err:      err,
+		})
+	}
+
+	return
+}
+
+// fromEndpointSlices discovers the daemons through the EndpointSlices of
+// the configured Service
+func (d *Discovery) fromEndpointSlices() (daemons []Daemon) {
+	slices, err := d.slices.EndpointSlices(d.namespace).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: d.service,
+	}))
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+
+	for _, slice := range slices {
+		port, portErr := slicePort(slice, d.cfg.PortName)
+
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			pod, ok := d.store.Get(ep.TargetRef.Name, ep.TargetRef.Namespace)
+			if !ok {
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%s", ep.TargetRef.Namespace, ep.TargetRef.Name)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			daemon := Daemon{Pod: pod}
+
+			switch {
+			case portErr != nil:
+				daemon.Err = portErr
+			case len(ep.Addresses) == 0:
+				daemon.Err = errors.New("endpoint has no addresses")
+			case ep.Conditions.Ready != nil && !*ep.Conditions.Ready:
+				daemon.Err = fmt.Errorf("pod %s is not ready", key)
+			default:
+				daemon.Endpoint = net.JoinHostPort(ep.Addresses[0], strconv.Itoa(int(port)))
+			}
+
+			daemons = append(daemons, daemon)
+		}
+	}
+
+	return
+}
+
+// slicePort takes in an EndpointSlice and a port name and returns the
+// port number with that name, if the name is empty then the first port
+// is returned
+func slicePort(slice *discoveryv1.EndpointSlice, name string) (int32, error) {
+	for _, port := range slice.Ports {
+		if port.Port == nil {
+			continue
+		}
+
+		if name == "" || (port.Name != nil && *port.Name == name) {
+			return *port.Port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("port %q not found in endpoint slice %s", name, slice.GetName())
+}
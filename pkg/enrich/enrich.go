@@ -0,0 +1,96 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sagacious-labs/k8trics/pkg/workload"
+)
+
+// defaultLabels are the pod labels attached to the data when no allow-list
+// is configured
+const defaultLabels = "app,app.kubernetes.io/name,app.kubernetes.io/instance,app.kubernetes.io/component,app.kubernetes.io/version"
+
+// Enricher attaches the kubernetes metadata of the pod which produced the
+// data of a module to the data
+//
+// The data is matched to the pod through its "container_id" field and is
+// enriched with the following fields:
+//
+//   - name: name of the workload of the pod
+//   - pod, namespace and node: name, namespace and node of the pod
+//   - container: name of the container
+//   - labels: the allow-listed labels of the pod
+//   - owner: kind and name of the workload of the pod
+type Enricher struct {
+	store    *store.PodStore
+	resolver *workload.Resolver
+
+	labels []string
+}
+
+// LabelsFromEnv reads the comma separated allow-list of the pod labels to
+// attach to the data from K8TRICS_ENRICH_LABELS, setting it to "-"
+// attaches no labels
+func LabelsFromEnv() []string {
+	allowed := []string{}
+
+	for _, label := range strings.Split(utils.GetEnv("K8TRICS_ENRICH_LABELS", defaultLabels), ",") {
+		if label = strings.TrimSpace(label); label != "" && label != "-" {
+			allowed = append(allowed, label)
+		}
+	}
+
+	return allowed
+}
+
+// New takes in the pod store, the workload resolver and the allow-list of
+// the pod labels and returns a new instance of Enricher
+func New(store *store.PodStore, resolver *workload.Resolver, labels []string) *Enricher {
+	return &Enricher{
+		store:    store,
+		resolver: resolver,
+		labels:   labels,
+	}
+}
+
+// Enrich takes in the data of a module, attaches the metadata of the pod
+// which produced it and returns the pod
+func (e *Enricher) Enrich(data map[string]interface{}) (*store.K8tricsPod, error) {
+	cid, ok := data["container_id"].(string)
+	if !ok {
+		return nil, errors.New("container_id not found in the retrieved data")
+	}
+
+	pod, ok := e.store.GetByContainerID(cid)
+	if !ok {
+		return nil, fmt.Errorf("no pod found for container id: %s", cid)
+	}
+
+	owner := e.resolver.Resolve(&pod.Pod)
+
+	data["name"] = owner.Name
+	data["pod"] = pod.GetName()
+	data["namespace"] = pod.GetNamespace()
+	data["node"] = pod.Spec.NodeName
+	if container, ok := pod.ContainerName(cid); ok {
+		data["container"] = container
+	}
+
+	labels := map[string]interface{}{}
+	for _, label := range e.labels {
+		if value, ok := pod.GetLabels()[label]; ok {
+			labels[label] = value
+		}
+	}
+	if len(labels) > 0 {
+		data["labels"] = labels
+	}
+
+	data["owner"] = map[string]interface{}{"kind": owner.Kind, "name": owner.Name}
+
+	return pod, nil
+}
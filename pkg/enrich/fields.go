@@ -0,0 +1,67 @@
+package enrich
+
+import "fmt"
+
+// metadataFields are the fields of the enriched data which describe where
+// the data comes from rather than being data
+var metadataFields = map[string]struct{}{
+	"container_id": {},
+	"container":    {},
+	"name":         {},
+	"namespace":    {},
+	"pod":          {},
+	"node":         {},
+	"labels":       {},
+	"owner":        {},
+}
+
+// NumericFields takes in the enriched data of a module and returns all of
+// the numeric fields in it, nested fields are joined with an underscore
+// and booleans are reported as 0 or 1
+//
+// The metadata fields attached by the enricher are left out
+func NumericFields(data map[string]interface{}) map[string]float64 {
+	fields := map[string]float64{}
+	flatten("", data, fields)
+
+	return fields
+}
+
+func flatten(prefix string, data map[string]interface{}, out map[string]float64) {
+	for k, v := range data {
+		if _, ok := metadataFields[k]; ok && prefix == "" {
+			continue
+		}
+
+		name := k
+		if prefix != "" {
+			name = fmt.Sprintf("%s_%s", prefix, k)
+		}
+
+		switch v := v.(type) {
+		case float64:
+			out[name] = v
+		case bool:
+			if v {
+				out[name] = 1
+			} else {
+				out[name] = 0
+			}
+		case map[string]interface{}:
+			flatten(name, v, out)
+		}
+	}
+}
+
+// Metadata takes in the enriched data of a module and returns only the
+// metadata fields attached by the enricher
+func Metadata(data map[string]interface{}) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(metadataFields))
+	for field := range metadataFields {
+		if value, ok := data[field]; ok {
+			metadata[field] = value
+		}
+	}
+
+	return metadata
+}
@@ -0,0 +1,325 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// namespace is the prefix of every metric exported by k8trics
+	namespace = "k8trics"
+
+	// resyncInterval is the interval at which the exporter makes sure that
+	// there is a subscription for every module on every daemon
+	resyncInterval = 10 * time.Second
+
+	// sampleTTL is the duration after which a sample which has not been
+	// updated is no longer exported
+	sampleTTL = 5 * time.Minute
+)
+
+var (
+	// metricLabels are the labels attached to every module metric
+	metricLabels = []string{"module", "workload", "pod", "namespace", "container"}
+
+	invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// Exporter keeps a background WatchData subscription per applied module
+// on every hyperion daemon and exposes the latest samples as prometheus
+// metrics
+//
+// Numeric fields of the module data are exported as gauges, fields with
+// a "_total" suffix are exported as counters
+type Exporter struct {
+	store     *store.PodStore
+	pool      *rpc.Pool
+	discovery *discovery.Discovery
+	enricher  *enrich.Enricher
+
+	// modules maps module name to the subscriptions of that module keyed
+	// by the daemon endpoint
+	modules map[string]map[string]*subscription
+	samples map[sampleKey]sample
+
+	// sinks receive every sample of the subscribed modules
+	sinks []func(module string, item *rpc.WatchDataResponse)
+
+	lock sync.Mutex
+}
+
+// subscription is a WatchData subscription of a module on a daemon, it is
+// recorded before the daemon is dialed so that concurrent resyncs do not
+// subscribe twice
+type subscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type sampleKey struct {
+	metric    string
+	module    string
+	workload  string
+	pod       string
+	namespace string
+	container string
+}
+
+type sample struct {
+	value     float64
+	valueType prometheus.ValueType
+	updated   time.Time
+}
+
+// New returns a new instance of the exporter
+func New(store *store.PodStore, pool *rpc.Pool, discovery *discovery.Discovery, enricher *enrich.Enricher) *Exporter {
+	return &Exporter{
+		store:     store,
+		pool:      pool,
+		discovery: discovery,
+		enricher:  enricher,
+		modules:   make(map[string]map[string]*subscription),
+		samples:   make(map[sampleKey]sample),
+	}
+}
+
+// OnSample takes in a sink which receives every enriched sample of the
+// subscribed modules, it must be called before Start
+func (e *Exporter) OnSample(sink func(module string, item *rpc.WatchDataResponse)) {
+	e.sinks = append(e.sinks, sink)
+}
+
+// Start starts the subscription loop of the exporter, the loop runs
+// until the stop channel is closed
+func (e *Exporter) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				e.stopAll()
+				return
+			case <-ticker.C:
+				e.resync()
+			}
+		}
+	}()
+}
+
+// Subscribe takes in a module name and starts exporting the data of the
+// module from every daemon
+func (e *Exporter) Subscribe(module string) {
+	e.lock.Lock()
+	if _, ok := e.modules[module]; !ok {
+		e.modules[module] = make(map[string]*subscription)
+	}
+	e.lock.Unlock()
+
+	e.resync()
+}
+
+// Unsubscribe takes in a module name, stops the subscriptions for the
+// module and drops its samples
+func (e *Exporter) Unsubscribe(module string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, sub := range e.modules[module] {
+		sub.cancel()
+	}
+	delete(e.modules, module)
+
+	for key := range e.samples {
+		if key.module == module {
+			delete(e.samples, key)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector, the exporter is an unchecked
+// collector as the metrics depend on the module data
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := time.Now()
+
+	for key, smpl := range e.samples {
+		if now.Sub(smpl.updated) > sampleTTL {
+			delete(e.samples, key)
+			continue
+		}
+
+		desc := prometheus.NewDesc(key.metric, "Module data reported by hyperion", metricLabels, nil)
+		metric, err := prometheus.NewConstMetric(desc, smpl.valueType, smpl.value, key.module, key.workload, key.pod, key.namespace, key.container)
+		if err != nil {
+			logrus.Warn("failed to create metric: ", err)
+			continue
+		}
+
+		ch <- metric
+	}
+}
+
+// resync makes sure that there is a running subscription for each of the
+// modules on every ready daemon
+//
+// The missing subscriptions are recorded under the lock while the daemons
+// are dialed outside of it, each in its own goroutine, so that a slow
+// daemon holds up neither the other daemons nor the callers
+func (e *Exporter) resync() {
+	daemons := e.discovery.Ready()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for module, subs := range e.modules {
+		for _, daemon := range daemons {
+			if _, ok := subs[daemon.Endpoint]; ok || !e.pool.Healthy(daemon.Endpoint) {
+				continue
+			}
+
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "enricher", e.enricher))
+			sub := &subscription{ctx: ctx, cancel: cancel}
+			subs[daemon.Endpoint] = sub
+
+			go e.subscribe(module, daemon, sub)
+		}
+	}
+}
+
+// subscribe takes in a module, a daemon and the subscription recorded for
+// them and starts watching the data of the module on the daemon, the
+// subscription is dropped if it fails so that it is retried on the next
+// resync
+func (e *Exporter) subscribe(module string, daemon discovery.Daemon, sub *subscription) {
+	endpoint := daemon.Endpoint
+
+	conn, err := e.pool.Get(endpoint, daemon.Pod)
+	if err != nil {
+		logrus.Warnf("failed to connect to daemon %s: %s", endpoint, err)
+		e.drop(module, endpoint, sub)
+		return
+	}
+
+	ch, streamErr, err := rpc.HyperionWatchData(sub.ctx, &api.WatchDataRequest{
+		Filter: &base.ModuleCore{Name: module},
+	}, conn)
+	if err != nil {
+		logrus.Warnf("failed to watch data of module %s on daemon %s: %s", module, endpoint, err)
+		e.drop(module, endpoint, sub)
+		return
+	}
+
+	e.consume(module, endpoint, ch, streamErr, sub)
+}
+
+// consume reads the samples from the channel until it is closed and then
+// drops the subscription so that it is recreated on the next resync
+func (e *Exporter) consume(module, endpoint string, ch chan *rpc.WatchDataResponse, streamErr rpc.StreamErr, sub *subscription) {
+	for item := range ch {
+		e.record(module, item.Data)
+
+		for _, sink := range e.sinks {
+			sink(module, item)
+		}
+	}
+
+	if err := streamErr(); err != nil {
+		logrus.Warnf("watch data stream of module %s on daemon %s failed: %s", module, endpoint, err)
+	}
+
+	e.drop(module, endpoint, sub)
+}
+
+// drop takes in a module, a daemon endpoint and a subscription, cancels
+// the subscription and forgets it unless it has already been replaced
+func (e *Exporter) drop(module, endpoint string, sub *subscription) {
+	sub.cancel()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if subs, ok := e.modules[module]; ok && subs[endpoint] == sub {
+		delete(subs, endpoint)
+	}
+}
+
+// record takes in the module name and the enriched module data and
+// stores every numeric field as a sample
+func (e *Exporter) record(module string, data map[string]interface{}) {
+	workload, _ := data["name"].(string)
+	pod, _ := data["pod"].(string)
+	ns, _ := data["namespace"].(string)
+	container, _ := data["container"].(string)
+
+	fields := enrich.NumericFields(data)
+
+	now := time.Now()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// Module may have been unsubscribed while the sample was in flight
+	if _, ok := e.modules[module]; !ok {
+		return
+	}
+
+	for field, value := range fields {
+		valueType := prometheus.GaugeValue
+		if strings.HasSuffix(field, "_total") {
+			valueType = prometheus.CounterValue
+		}
+
+		e.samples[sampleKey{
+			metric:    metricName(module, field),
+			module:    module,
+			workload:  workload,
+			pod:       pod,
+			namespace: ns,
+			container: container,
+		}] = sample{
+			value:     value,
+			valueType: valueType,
+			updated:   now,
+		}
+	}
+}
+
+// stopAll cancels every running subscription
+func (e *Exporter) stopAll() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, subs := range e.modules {
+		for endpoint, sub := range subs {
+			sub.cancel()
+			delete(subs, endpoint)
+		}
+	}
+}
+
+// metricName takes in the module name and the field name and returns a
+// valid prometheus metric name for the pair
+func metricName(module, field string) string {
+	name := fmt.Sprintf("%s_%s_%s", namespace, module, field)
+	return invalidMetricChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,227 @@
+package fanin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Policy decides what happens to the events of the upstreams when the
+// merged channel is full, i.e. when the consumer is slower than the
+// upstreams
+type Policy string
+
+const (
+	// PolicyBlock blocks the upstreams until the consumer catches up
+	PolicyBlock Policy = "block"
+
+	// PolicyDropOldest drops the oldest buffered event to make room for
+	// the new one
+	PolicyDropOldest Policy = "drop-oldest"
+
+	// PolicySample keeps only one out of every SampleRate events while the
+	// merged channel is full and drops the rest
+	PolicySample Policy = "sample"
+)
+
+// ParsePolicy takes in the name of a policy and returns the policy
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case PolicyBlock, PolicyDropOldest, PolicySample:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid overflow policy %q", name)
+	}
+}
+
+// Config is the configuration of a multiplexer
+type Config struct {
+	// Buffer is the capacity of the merged channel
+	Buffer int
+	// Policy is the overflow policy of the merged channel
+	Policy Policy
+	// SampleRate is the rate at which the events are kept under the
+	// sample policy
+	SampleRate int
+}
+
+// DroppedEvents counts the events dropped by all of the multiplexers due
+// to their overflow policy
+var DroppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "k8trics",
+	Subsystem: "stream",
+	Name:      "dropped_events_total",
+	Help:      "Number of stream events dropped due to the overflow policy",
+}, []string{"policy"})
+
+// ConfigFromEnv reads the environmental variables and returns the default
+// configuration of the multiplexers
+func ConfigFromEnv() Config {
+	policy, err := ParsePolicy(utils.GetEnv("K8TRICS_STREAM_OVERFLOW_POLICY", string(PolicyBlock)))
+	if err != nil {
+		logrus.Warnf("%s, using %s", err, PolicyBlock)
+		policy = PolicyBlock
+	}
+
+	return Config{
+		Buffer:     utils.GetEnvInt("K8TRICS_STREAM_BUFFER", 64),
+		Policy:     policy,
+		SampleRate: utils.GetEnvInt("K8TRICS_STREAM_SAMPLE_RATE", 10),
+	}
+}
+
+// Emit writes an event on the merged channel according to the overflow
+// policy, it returns false once the multiplexer is closed in which case
+// the upstream must stop
+type Emit func(item interface{}) bool
+
+// Mux merges the events of several upstreams into a single bounded
+// channel
+//
+// The merged channel is closed once all of the upstreams have finished
+// and Seal has been called. Closing the multiplexer cancels the context
+// passed to the upstreams
+type Mux struct {
+	// dropped and overflow are accessed atomically and are kept first to
+	// keep them 64-bit aligned on 32-bit platforms
+	dropped  uint64
+	overflow uint64
+
+	cfg Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	out chan interface{}
+	wg  sync.WaitGroup
+
+	// lock serialises the writers under the drop-oldest policy so that the
+	// dropped event always makes room for the event being written
+	lock sync.Mutex
+
+	sealOnce sync.Once
+}
+
+// New takes in a parent context and the configuration and returns a new
+// multiplexer, cancelling the parent context closes the multiplexer
+func New(parent context.Context, cfg Config) *Mux {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 1
+	}
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = 1
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = PolicyBlock
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+
+	return &Mux{
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+		out:    make(chan interface{}, cfg.Buffer),
+	}
+}
+
+// Go starts the given upstream in a goroutine, the upstream must write
+// its events using the emit function and must return once the context is
+// cancelled
+func (m *Mux) Go(upstream func(ctx context.Context, emit Emit)) {
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+		upstream(m.ctx, m.emit)
+	}()
+}
+
+// Seal marks that no more upstreams will be added, the merged channel is
+// closed once all of the running upstreams have finished
+func (m *Mux) Seal() {
+	m.sealOnce.Do(func() {
+		go func() {
+			m.wg.Wait()
+			close(m.out)
+		}()
+	})
+}
+
+// Out returns the merged channel
+func (m *Mux) Out() <-chan interface{} {
+	return m.out
+}
+
+// Close cancels all of the upstreams, it should be called once the
+// consumer stops reading from the merged channel
+func (m *Mux) Close() {
+	m.cancel()
+	m.Seal()
+}
+
+// Dropped returns the number of events dropped due to the overflow policy
+func (m *Mux) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+func (m *Mux) emit(item interface{}) bool {
+	if m.ctx.Err() != nil {
+		return false
+	}
+
+	// Fast path, there is room in the merged channel
+	select {
+	case m.out <- item:
+		return true
+	default:
+	}
+
+	switch m.cfg.Policy {
+	case PolicyDropOldest:
+		return m.emitDropOldest(item)
+	case PolicySample:
+		if atomic.AddUint64(&m.overflow, 1)%uint64(m.cfg.SampleRate) != 0 {
+			m.drop()
+			return true
+		}
+	}
+
+	select {
+	case m.out <- item:
+		return true
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+func (m *Mux) emitDropOldest(item interface{}) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for {
+		select {
+		case m.out <- item:
+			return true
+		case <-m.ctx.Done():
+			return false
+		default:
+		}
+
+		select {
+		case <-m.out:
+			m.drop()
+		default:
+		}
+	}
+}
+
+func (m *Mux) drop() {
+	atomic.AddUint64(&m.dropped, 1)
+	DroppedEvents.WithLabelValues(string(m.cfg.Policy)).Inc()
+}
@@ -0,0 +1,199 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanin"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"google.golang.org/grpc"
+)
+
+// ErrNoDaemons is returned when there are no hyperion daemons to forward
+// the request to
+var ErrNoDaemons = errors.New("no hyperion daemons available")
+
+// Event is an item of a merged stream which carries a notification about
+// the stream itself, eg. an error or a reconnect attempt, instead of the
+// data of a daemon
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+// Upstream takes in a context and a connection to a daemon, opens a
+// stream on the daemon and writes its items using emit until the stream
+// ends or the context is cancelled
+type Upstream func(ctx context.Context, conn *grpc.ClientConn, emit fanin.Emit) error
+
+// Fanout forwards the requests to the hyperion daemons and aggregates
+// their responses, it is shared by all of the APIs exposed by k8trics
+type Fanout struct {
+	discovery *discovery.Discovery
+	pool      *rpc.Pool
+
+	// concurrency is the maximum number of daemons a request is sent to
+	// at the same time
+	concurrency int
+}
+
+// New takes in the maximum number of daemons a request is sent to at the
+// same time and returns a new instance of Fanout
+func New(discovery *discovery.Discovery, pool *rpc.Pool, concurrency int) *Fanout {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Fanout{
+		discovery:   discovery,
+		pool:        pool,
+		concurrency: concurrency,
+	}
+}
+
+// Request fans the request out to every daemon matching the filter and
+// collects the outcome of each of them
+func (f *Fanout) Request(filter discovery.NodeFilter, fn func(conn *grpc.ClientConn) (interface{}, error)) *Result {
+	return f.RequestDaemons(f.discovery.Select(filter), fn)
+}
+
+// RequestDaemons fans the request out to the given daemons, usually a
+// subset of the ones matching a filter, and collects the outcome of each
+// of them
+//
+// The daemons are requested in parallel, bounded by the concurrency of
+// the fanout, and their outcomes are recorded in the order of the daemons
+func (f *Fanout) RequestDaemons(daemons []discovery.Daemon, fn func(conn *grpc.ClientConn) (interface{}, error)) *Result {
+	result := newResult()
+
+	if len(daemons) == 0 {
+		result.Msg = ErrNoDaemons.Error()
+		return result
+	}
+
+	type outcome struct {
+		res         interface{}
+		err         error
+		latency     time.Duration
+		unavailable bool
+	}
+
+	outcomes := make([]outcome, len(daemons))
+	sem := make(chan struct{}, f.concurrency)
+
+	var wg sync.WaitGroup
+	for i, daemon := range daemons {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, daemon discovery.Daemon) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			conn, err := f.connect(daemon)
+			if err != nil {
+				outcomes[i] = outcome{err: err, unavailable: true}
+				return
+			}
+
+			start := time.Now()
+			res, err := fn(conn)
+			outcomes[i] = outcome{res: res, err: err, latency: time.Since(start)}
+		}(i, daemon)
+	}
+	wg.Wait()
+
+	for i, daemon := range daemons {
+		if o := outcomes[i]; o.unavailable {
+			result.addUnavailable(daemon, o.err)
+		} else {
+			result.add(daemon, o.res, o.err, o.latency)
+		}
+	}
+
+	return result
+}
+
+// Stream opens a stream on every daemon matching the filter and merges
+// them using the multiplexer
+//
+// The daemons which cannot be contacted are reported as "error" events on
+// the merged stream, an error is returned only if none of the daemons
+// could be contacted
+func (f *Fanout) Stream(mux *fanin.Mux, filter discovery.NodeFilter, fn Upstream) error {
+	defer mux.Seal()
+
+	errs := []error{}
+
+	daemons := f.discovery.Select(filter)
+	if len(daemons) == 0 {
+		return ErrNoDaemons
+	}
+
+	for _, daemon := range daemons {
+		daemon := daemon
+
+		conn, err := f.connect(daemon)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		mux.Go(func(ctx context.Context, emit fanin.Emit) {
+			if err := fn(ctx, conn, emit); err != nil {
+				emit(Event{
+					Name: "error",
+					Data: map[string]interface{}{"node": daemon.Pod.Spec.NodeName, "msg": err.Error()},
+				})
+			}
+		})
+	}
+
+	if len(errs) == len(daemons) {
+		return mergeErrors(errs)
+	}
+
+	for _, err := range errs {
+		err := err
+		mux.Go(func(ctx context.Context, emit fanin.Emit) {
+			emit(Event{Name: "error", Data: map[string]interface{}{"msg": err.Error()}})
+		})
+	}
+
+	return nil
+}
+
+// connect takes in a daemon and returns the pooled connection to it,
+// daemons whose connection is known to be failing are skipped
+func (f *Fanout) connect(daemon discovery.Daemon) (*grpc.ClientConn, error) {
+	if daemon.Err != nil {
+		return nil, daemon.Err
+	}
+
+	if !f.pool.Healthy(daemon.Endpoint) {
+		return nil, fmt.Errorf("daemon %s at %s is unavailable: %s", daemon.Pod.GetName(), daemon.Endpoint, f.pool.State(daemon.Endpoint))
+	}
+
+	return f.pool.Get(daemon.Endpoint, daemon.Pod)
+}
+
+func mergeErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	errStrs := []string{}
+
+	for _, err := range errs {
+		errStrs = append(errStrs, err.Error())
+	}
+
+	return errors.New(strings.Join(errStrs, "\n"))
+}
@@ -0,0 +1,127 @@
+package fanout
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DaemonResult is the outcome of a request on a single hyperion daemon
+type DaemonResult struct {
+	Pod       string      `json:"pod"`
+	Node      string      `json:"node"`
+	Endpoint  string      `json:"endpoint,omitempty"`
+	LatencyMs float64     `json:"latencyMs"`
+	Code      string      `json:"code"`
+	Response  interface{} `json:"response,omitempty"`
+	Error     string      `json:"error,omitempty"`
+
+	err error
+}
+
+// Result is the outcome of a request fanned out to the hyperion daemons,
+// it carries the outcome of the request on every daemon along with the
+// nodes on which the request succeeded and failed so that the clients can
+// retry only the failed nodes
+type Result struct {
+	Msg       string   `json:"msg,omitempty"`
+	Succeeded []string `json:"succeeded"`
+	Failed    []string `json:"failed"`
+	// Skipped are the nodes which were deliberately not contacted
+	Skipped []string       `json:"skipped,omitempty"`
+	Results []DaemonResult `json:"results"`
+}
+
+// newResult returns an empty result
+func newResult() *Result {
+	return &Result{
+		Succeeded: []string{},
+		Failed:    []string{},
+		Results:   []DaemonResult{},
+	}
+}
+
+// add takes in a daemon, the response of the daemon or the error and the
+// time taken by the request and records it in the result
+func (r *Result) add(daemon discovery.Daemon, res interface{}, err error, latency time.Duration) {
+	result := DaemonResult{
+		Pod:       daemon.Pod.GetName(),
+		Node:      daemon.Pod.Spec.NodeName,
+		Endpoint:  daemon.Endpoint,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		Code:      status.Code(err).String(),
+		Response:  res,
+	}
+
+	if err != nil {
+		result.Response = nil
+		result.Error = err.Error()
+		result.err = err
+		r.Failed = append(r.Failed, result.Node)
+	} else {
+		r.Succeeded = append(r.Succeeded, result.Node)
+	}
+
+	r.Results = append(r.Results, result)
+}
+
+// addUnavailable takes in a daemon which could not be contacted along
+// with the reason and records it in the result
+func (r *Result) addUnavailable(daemon discovery.Daemon, err error) {
+	r.add(daemon, nil, status.Error(codes.Unavailable, err.Error()), 0)
+}
+
+// Fail takes in a daemon which was not contacted as the request cannot
+// succeed on it along with the reason and records it as failed
+func (r *Result) Fail(daemon discovery.Daemon, err error) {
+	r.add(daemon, nil, status.Error(codes.FailedPrecondition, err.Error()), 0)
+}
+
+// Skip takes in a daemon which was deliberately not contacted and records
+// its node as skipped
+func (r *Result) Skip(daemon discovery.Daemon) {
+	r.Skipped = append(r.Skipped, daemon.Pod.Spec.NodeName)
+}
+
+// Status takes in the status code to be used when the request succeeds on
+// every daemon and returns the HTTP status code of the result
+//
+// If the request succeeded only on some of the daemons then 207 (Multi
+// Status) is returned, if it failed on all of them then 502 (Bad Gateway)
+// is returned and if there were no daemons to send the request to then
+// 503 (Service Unavailable) is returned
+func (r *Result) Status(success int) int {
+	switch {
+	case len(r.Results) == 0:
+		return http.StatusServiceUnavailable
+	case len(r.Failed) == 0:
+		return success
+	case len(r.Succeeded) == 0:
+		return http.StatusBadGateway
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
+// Ok returns true if the request succeeded on at least one daemon
+func (r *Result) Ok() bool {
+	return len(r.Succeeded) > 0
+}
+
+// Err returns nil if the request succeeded on at least one daemon or else
+// returns the error of the first daemon, ErrNoDaemons is returned if there
+// were no daemons to send the request to
+func (r *Result) Err() error {
+	if len(r.Results) == 0 {
+		return ErrNoDaemons
+	}
+
+	if r.Ok() {
+		return nil
+	}
+
+	return r.Results[0].err
+}
@@ -0,0 +1,157 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanin"
+)
+
+const (
+	// minReconnectBackoff is the delay before the first reconnect attempt
+	// after a watch stream breaks
+	minReconnectBackoff = 500 * time.Millisecond
+
+	// maxReconnectBackoff is the upper bound of the delay between the
+	// reconnect attempts
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// receivedKey is the context key of the flag recording that an upstream
+// received an item from its daemon
+type receivedKey struct{}
+
+// Received takes in the context of an upstream and records that an item
+// was received from the daemon, whether or not the item is emitted, so
+// that a healthy stream whose items are filtered out still resets the
+// reconnect backoff
+func Received(ctx context.Context) {
+	if received, ok := ctx.Value(receivedKey{}).(*bool); ok {
+		*received = true
+	}
+}
+
+// Watch opens a resumable stream on every node running a daemon matching
+// the filter and merges them using the multiplexer
+//
+// The streams are kept open until the multiplexer is closed, a broken
+// stream is reopened against the daemon on the same node, which may be a
+// replacement of the original daemon pod
+func (f *Fanout) Watch(mux *fanin.Mux, filter discovery.NodeFilter, fn Upstream) error {
+	defer mux.Seal()
+
+	nodes := map[string]struct{}{}
+	for _, daemon := range f.discovery.Select(filter) {
+		if node := daemon.Pod.Spec.NodeName; node != "" {
+			nodes[node] = struct{}{}
+		}
+	}
+
+	if len(nodes) == 0 {
+		return ErrNoDaemons
+	}
+
+	for node := range nodes {
+		node := node
+		mux.Go(func(ctx context.Context, emit fanin.Emit) {
+			f.watch(ctx, node, fn, emit)
+		})
+	}
+
+	return nil
+}
+
+// watch keeps a stream open to the daemon running on the given node until
+// the context is cancelled, the stream is reopened with an exponential
+// backoff whenever it breaks
+//
+// Every failure is reported as an "error" event and every reconnect
+// attempt as a "reconnect" event
+func (f *Fanout) watch(ctx context.Context, node string, fn Upstream, emit fanin.Emit) {
+	backoff := minReconnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		received, err := f.watchOnce(ctx, node, fn, emit)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if received {
+			backoff = minReconnectBackoff
+		}
+
+		if !emit(Event{
+			Name: "error",
+			Data: map[string]interface{}{"node": node, "msg": err.Error()},
+		}) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+
+		if !emit(Event{
+			Name: "reconnect",
+			Data: map[string]interface{}{"node": node, "attempt": attempt},
+		}) {
+			return
+		}
+	}
+}
+
+// watchOnce opens a stream to the daemon running on the given node and
+// forwards the items until the stream ends, it returns whether any item
+// was received, see Received, and the reason the stream ended
+func (f *Fanout) watchOnce(ctx context.Context, node string, fn Upstream, emit fanin.Emit) (bool, error) {
+	daemon, err := f.nodeDaemon(node)
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := f.connect(daemon)
+	if err != nil {
+		return false, err
+	}
+
+	received := false
+
+	streamCtx, cancel := context.WithCancel(context.WithValue(ctx, receivedKey{}, &received))
+	defer cancel()
+
+	err = fn(streamCtx, conn, func(item interface{}) bool {
+		received = true
+		return emit(item)
+	})
+	if err != nil {
+		return received, fmt.Errorf("stream from daemon %s failed: %w", daemon.Pod.GetName(), err)
+	}
+
+	return received, fmt.Errorf("stream from daemon %s closed", daemon.Pod.GetName())
+}
+
+// nodeDaemon takes in a node name and returns the ready daemon running on
+// that node
+func (f *Fanout) nodeDaemon(node string) (discovery.Daemon, error) {
+	daemons := f.discovery.Select(discovery.NodeFilter{Names: []string{node}})
+
+	for _, daemon := range daemons {
+		if daemon.Err == nil {
+			return daemon, nil
+		}
+	}
+
+	if len(daemons) > 0 {
+		return discovery.Daemon{}, daemons[0].Err
+	}
+
+	return discovery.Daemon{}, fmt.Errorf("no hyperion daemon found on node %s", node)
+}
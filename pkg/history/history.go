@@ -0,0 +1,504 @@
+package history
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+)
+
+const (
+	// pruneInterval is the interval at which the expired samples are
+	// dropped
+	pruneInterval = time.Minute
+
+	// sampleOverhead is the size of a sample in the ring buffer besides
+	// its values
+	sampleOverhead = 32
+	// seriesOverhead is the estimated size of a series besides its key,
+	// its fields, its metadata and its samples
+	seriesOverhead = 256
+	// entryOverhead is the estimated size of an entry of a map or a slice
+	// besides its content, eg. the headers of the strings and the buckets
+	entryOverhead = 48
+)
+
+// Config is the configuration of the store
+type Config struct {
+	// Retention is the duration for which the samples are kept
+	Retention time.Duration
+	// SeriesSamples is the capacity of the ring buffer of every series
+	SeriesSamples int
+	// MaxBytes caps the estimated memory used by the series, the least
+	// recently updated series are dropped beyond it
+	MaxBytes int64
+}
+
+// ConfigFromEnv reads the environmental variables and returns the
+// configuration of the store
+func ConfigFromEnv() Config {
+	return Config{
+		Retention:     utils.GetEnvDuration("K8TRICS_HISTORY_RETENTION", 15*time.Minute),
+		SeriesSamples: utils.GetEnvInt("K8TRICS_HISTORY_SERIES_SAMPLES", 1024),
+		MaxBytes:      int64(utils.GetEnvInt("K8TRICS_HISTORY_MAX_BYTES", 64<<20)),
+	}
+}
+
+// Point is the value of the numeric fields of a series at a point in time
+type Point struct {
+	Time   time.Time          `json:"t"`
+	Fields map[string]float64 `json:"fields"`
+}
+
+// Series is the history of the data of a container of a pod
+type Series struct {
+	// Metadata are the metadata fields of the latest sample of the series
+	Metadata map[string]interface{} `json:"metadata"`
+	Points   []Point                `json:"points"`
+}
+
+// Query is a range query on the history of a module
+type Query struct {
+	Start, End time.Time
+	// Step is the resolution of the points, the samples are averaged over
+	// every step. Zero returns the raw samples
+	Step time.Duration
+	// Fields are the fields to return, empty means every field
+	Fields []string
+	// Match selects the series by the metadata and the pod of their latest
+	// sample, nil matches every series
+	Match func(metadata map[string]interface{}, pod *store.K8tricsPod) bool
+}
+
+// Store retains the enriched samples of the modules in memory, every
+// series, ie. every container of every pod of a module, is kept in a ring
+// buffer bounded by the sample capacity and the retention
+//
+// The store is fed with the samples of the exporter, hence only the
+// modules to which the exporter is subscribed are retained
+type Store struct {
+	cfg Config
+
+	// series is keyed by module and then by series key
+	series map[string]map[string]*ring
+	bytes  int64
+
+	lock sync.RWMutex
+}
+
+// New takes in the configuration and returns a new, empty, store
+func New(cfg Config) *Store {
+	if cfg.SeriesSamples <= 0 {
+		cfg.SeriesSamples = 1
+	}
+
+	return &Store{
+		cfg:    cfg,
+		series: make(map[string]map[string]*ring),
+	}
+}
+
+// Record takes in the name of a module and a sample of the module and
+// retains the sample
+func (s *Store) Record(module string, item *rpc.WatchDataResponse) {
+	metadata := enrich.Metadata(item.Data)
+	namespace, _ := metadata["namespace"].(string)
+	pod, _ := metadata["pod"].(string)
+	container, _ := metadata["container"].(string)
+	if pod == "" {
+		return
+	}
+
+	key := namespace + "/" + pod + "/" + container
+	fields := enrich.NumericFields(item.Data)
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	series, ok := s.series[module]
+	if !ok {
+		series = make(map[string]*ring)
+		s.series[module] = series
+	}
+
+	r, ok := series[key]
+	if !ok {
+		r = newRing(key, s.cfg.SeriesSamples)
+		series[key] = r
+		s.bytes += r.bytes
+	}
+
+	s.bytes += r.describe(metadata, item.Pod)
+	s.bytes += r.add(now, fields)
+
+	if s.cfg.MaxBytes > 0 && s.bytes > s.cfg.MaxBytes {
+		s.evict()
+	}
+}
+
+// Range takes in the name of a module and a query and returns the series
+// of the module matching the query
+func (s *Store) Range(module string, q Query) ([]Series, error) {
+	if q.End.Before(q.Start) {
+		return nil, errors.New("end must not be before start")
+	}
+
+	// The samples older than the retention may not have been pruned yet
+	if oldest := time.Now().Add(-s.cfg.Retention); q.Start.Before(oldest) {
+		q.Start = oldest
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	result := []Series{}
+
+	for _, r := range s.series[module] {
+		if q.Match != nil && !q.Match(r.metadata, r.pod) {
+			continue
+		}
+
+		points := r.points(q)
+		if len(points) == 0 {
+			continue
+		}
+
+		result = append(result, Series{Metadata: r.metadata, Points: points})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return seriesKey(result[i].Metadata) < seriesKey(result[j].Metadata)
+	})
+
+	return result, nil
+}
+
+// Start starts dropping the expired samples, it runs until the stop
+// channel is closed
+func (s *Store) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				s.prune(now.Add(-s.cfg.Retention))
+			}
+		}
+	}()
+}
+
+// prune drops the samples older than the given time and the series which
+// are left empty
+func (s *Store) prune(oldest time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for module, series := range s.series {
+		for key, r := range series {
+			s.bytes -= r.expire(oldest)
+			if r.size == 0 {
+				s.bytes -= r.bytes
+				delete(series, key)
+			}
+		}
+
+		if len(series) == 0 {
+			delete(s.series, module)
+		}
+	}
+}
+
+// evict drops the least recently updated series until the memory used is
+// back under 90% of the cap, the caller must hold the lock
+func (s *Store) evict() {
+	target := s.cfg.MaxBytes / 10 * 9
+
+	type candidate struct {
+		module, key string
+		updated     time.Time
+	}
+
+	candidates := []candidate{}
+	for module, series := range s.series {
+		for key, r := range series {
+			candidates = append(candidates, candidate{module, key, r.updated()})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].updated.Before(candidates[j].updated)
+	})
+
+	for _, c := range candidates {
+		if s.bytes <= target {
+			return
+		}
+
+		s.bytes -= s.series[c.module][c.key].bytes
+		delete(s.series[c.module], c.key)
+		if len(s.series[c.module]) == 0 {
+			delete(s.series, c.module)
+		}
+	}
+}
+
+func seriesKey(metadata map[string]interface{}) string {
+	namespace, _ := metadata["namespace"].(string)
+	pod, _ := metadata["pod"].(string)
+	container, _ := metadata["container"].(string)
+
+	return namespace + "/" + pod + "/" + container
+}
+
+// sample is a single sample of a series, values are indexed by the fields
+// of the series, the fields added after the sample are missing from it
+type sample struct {
+	time   int64
+	values []float64
+}
+
+// ring is the ring buffer of the samples of a series
+type ring struct {
+	fields []string
+	index  map[string]int
+
+	samples []sample
+	head    int
+	size    int
+	// bytes is the estimated memory used by the series, including its
+	// key, its fields and its metadata
+	bytes int64
+
+	metadata map[string]interface{}
+	pod      *store.K8tricsPod
+	// described is the estimated memory used by the metadata and the pod
+	described int64
+}
+
+func newRing(key string, capacity int) *ring {
+	return &ring{
+		index:   make(map[string]int),
+		samples: make([]sample, capacity),
+		bytes:   seriesOverhead + int64(len(key)) + int64(capacity)*sampleOverhead,
+	}
+}
+
+// describe takes in the metadata and the pod of the latest sample and
+// returns the change in the estimated memory used
+//
+// Only the fields of the pod used to match the series are kept, the rest
+// of the pod would be retained for as long as the series otherwise
+func (r *ring) describe(metadata map[string]interface{}, pod *store.K8tricsPod) int64 {
+	r.metadata = metadata
+	r.pod = nil
+
+	described := valueBytes(metadata)
+	if pod != nil {
+		slim := &store.K8tricsPod{}
+		slim.Name = pod.GetName()
+		slim.Namespace = pod.GetNamespace()
+		slim.Labels = pod.GetLabels()
+		slim.Spec.NodeName = pod.Spec.NodeName
+		r.pod = slim
+
+		described += int64(len(slim.Name)+len(slim.Namespace)+len(slim.Spec.NodeName)) + valueBytes(slim.Labels)
+	}
+
+	delta := described - r.described
+	r.described = described
+	r.bytes += delta
+
+	return delta
+}
+
+// add takes in a sample, overwriting the oldest one if the ring is full,
+// and returns the change in the estimated memory used
+func (r *ring) add(t time.Time, fields map[string]float64) int64 {
+	known := len(r.fields)
+
+	values := make([]float64, len(r.fields), len(r.fields)+len(fields))
+	for i := range values {
+		values[i] = math.NaN()
+	}
+
+	for field, value := range fields {
+		i, ok := r.index[field]
+		if !ok {
+			i = len(r.fields)
+			r.index[field] = i
+			r.fields = append(r.fields, field)
+			values = append(values, math.NaN())
+		}
+
+		values[i] = value
+	}
+
+	pos := (r.head + r.size) % len(r.samples)
+	delta := sampleBytes(values)
+	for _, field := range r.fields[known:] {
+		delta += 2*entryOverhead + int64(len(field))
+	}
+
+	if r.size == len(r.samples) {
+		delta -= sampleBytes(r.samples[r.head].values)
+		r.head = (r.head + 1) % len(r.samples)
+	} else {
+		r.size++
+	}
+
+	r.samples[pos] = sample{time: t.UnixNano(), values: values}
+	r.bytes += delta
+
+	return delta
+}
+
+// expire drops the samples older than the given time and returns the
+// memory released
+func (r *ring) expire(oldest time.Time) int64 {
+	released := int64(0)
+
+	for r.size > 0 && r.samples[r.head].time < oldest.UnixNano() {
+		released += sampleBytes(r.samples[r.head].values)
+		r.samples[r.head] = sample{}
+		r.head = (r.head + 1) % len(r.samples)
+		r.size--
+	}
+
+	r.bytes -= released
+	return released
+}
+
+// updated returns the time of the latest sample
+func (r *ring) updated() time.Time {
+	if r.size == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, r.samples[(r.head+r.size-1)%len(r.samples)].time)
+}
+
+// points takes in a query and returns the points of the samples in the
+// range of the query
+func (r *ring) points(q Query) []Point {
+	start, end := q.Start.UnixNano(), q.End.UnixNano()
+	step := q.Step.Nanoseconds()
+
+	fields := r.fields
+	if len(q.Fields) > 0 {
+		fields = q.Fields
+	}
+
+	points := []Point{}
+
+	// sums and counts accumulate the samples of the current step
+	bucket := int64(-1)
+	sums := map[string]float64{}
+	counts := map[string]int{}
+
+	flush := func() {
+		if bucket < 0 || len(counts) == 0 {
+			return
+		}
+
+		point := Point{Time: time.Unix(0, start+bucket*step), Fields: make(map[string]float64, len(counts))}
+		for field, count := range counts {
+			point.Fields[field] = sums[field] / float64(count)
+		}
+
+		points = append(points, point)
+		sums, counts = map[string]float64{}, map[string]int{}
+	}
+
+	for i := 0; i < r.size; i++ {
+		smpl := r.samples[(r.head+i)%len(r.samples)]
+		if smpl.time < start || smpl.time > end {
+			continue
+		}
+
+		if step <= 0 {
+			point := Point{Time: time.Unix(0, smpl.time), Fields: map[string]float64{}}
+			for _, field := range fields {
+				if value, ok := r.value(smpl, field); ok {
+					point.Fields[field] = value
+				}
+			}
+
+			if len(point.Fields) > 0 {
+				points = append(points, point)
+			}
+			continue
+		}
+
+		if b := (smpl.time - start) / step; b != bucket {
+			flush()
+			bucket = b
+		}
+
+		for _, field := range fields {
+			if value, ok := r.value(smpl, field); ok {
+				sums[field] += value
+				counts[field]++
+			}
+		}
+	}
+
+	flush()
+	return points
+}
+
+// value takes in a sample and a field and returns the value of the field
+// in the sample
+func (r *ring) value(smpl sample, field string) (float64, bool) {
+	i, ok := r.index[field]
+	if !ok || i >= len(smpl.values) || math.IsNaN(smpl.values[i]) {
+		return 0, false
+	}
+
+	return smpl.values[i], true
+}
+
+// sampleBytes takes in the values of a sample and returns their size, the
+// sample itself is accounted for by the ring buffer
+func sampleBytes(values []float64) int64 {
+	return 8 * int64(cap(values))
+}
+
+// valueBytes takes in a value decoded from the module data, or a map of
+// labels, and returns its estimated size
+func valueBytes(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return entryOverhead + int64(len(v))
+	case map[string]string:
+		size := int64(entryOverhead)
+		for key, val := range v {
+			size += 2*entryOverhead + int64(len(key)+len(val))
+		}
+		return size
+	case map[string]interface{}:
+		size := int64(entryOverhead)
+		for key, val := range v {
+			size += entryOverhead + int64(len(key)) + valueBytes(val)
+		}
+		return size
+	case []interface{}:
+		size := int64(entryOverhead)
+		for _, val := range v {
+			size += valueBytes(val)
+		}
+		return size
+	default:
+		return entryOverhead
+	}
+}
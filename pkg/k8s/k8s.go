@@ -3,6 +3,7 @@ package k8s
 import (
 	"time"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -11,13 +12,24 @@ import (
 
 type K8s struct {
 	clientset *kubernetes.Clientset
+	dynamic   dynamic.Interface
 	informers informers.SharedInformerFactory
 
 	stop chan struct{}
 }
 
 func New(kubeconfigLoc string) (*K8s, error) {
-	cs, err := setupClientset(kubeconfigLoc)
+	cfg, err := setupConfig(kubeconfigLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -26,21 +38,19 @@ func New(kubeconfigLoc string) (*K8s, error) {
 
 	return &K8s{
 		clientset: cs,
+		dynamic:   dyn,
 		informers: setupInformerFactory(cs, stop),
 		stop:      stop,
 	}, nil
 }
 
-func setupClientset(kubeconfigLoc string) (*kubernetes.Clientset, error) {
+func setupConfig(kubeconfigLoc string) (*rest.Config, error) {
 	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfigLoc)
 	if err != nil {
-		cfg, err = rest.InClusterConfig()
-		if err != nil {
-			return nil, err
-		}
+		return rest.InClusterConfig()
 	}
 
-	return kubernetes.NewForConfig(cfg)
+	return cfg, nil
 }
 
 func setupInformerFactory(cs *kubernetes.Clientset, ch chan struct{}) informers.SharedInformerFactory {
@@ -53,10 +63,18 @@ func (k8s *K8s) ClientSet() *kubernetes.Clientset {
 	return k8s.clientset
 }
 
+// Dynamic returns the dynamic client, it is used to access the custom
+// resources for which there are no typed clients
+func (k8s *K8s) Dynamic() dynamic.Interface {
+	return k8s.dynamic
+}
+
 func (k8s *K8s) Informers() informers.SharedInformerFactory {
 	return k8s.informers
 }
 
+// Close releases the resources held by the handler, it must be called
+// only once
 func (k8s *K8s) Close() {
-	k8s.stop <- struct{}{}
+	close(k8s.stop)
 }
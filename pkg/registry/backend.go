@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// configMapKey is the key of the ConfigMap under which the registry is
+// stored
+const configMapKey = "modules.json"
+
+// Backend persists the serialized registry
+type Backend interface {
+	// Load returns the serialized registry or nil if nothing was saved
+	Load(ctx context.Context) ([]byte, error)
+	// Save persists the serialized registry
+	Save(ctx context.Context, data []byte) error
+}
+
+// BackendFromEnv reads the environmental variables and returns the backend
+// of the registry
+//
+// K8TRICS_REGISTRY_CONFIGMAP selects a ConfigMap in the namespace set by
+// K8TRICS_REGISTRY_NAMESPACE, otherwise K8TRICS_REGISTRY_FILE selects a
+// local file. If neither is set then the registry is kept only in memory
+func BackendFromEnv(clientset kubernetes.Interface) Backend {
+	if name := utils.GetEnv("K8TRICS_REGISTRY_CONFIGMAP", ""); name != "" {
+		return NewConfigMapBackend(clientset, utils.GetEnv("K8TRICS_REGISTRY_NAMESPACE", "k8trics"), name)
+	}
+
+	if path := utils.GetEnv("K8TRICS_REGISTRY_FILE", ""); path != "" {
+		return NewFileBackend(path)
+	}
+
+	logrus.Warn("no registry backend configured, applied modules will be forgotten on restart")
+	return memoryBackend{}
+}
+
+// FileBackend persists the registry to a local file
+type FileBackend struct {
+	path string
+}
+
+// NewFileBackend takes in the path of a file and returns a backend which
+// persists the registry to it
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+func (b *FileBackend) Load(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// Save writes the registry to a temporary file which is then renamed so
+// that a crash never leaves a partially written registry behind
+func (b *FileBackend) Save(ctx context.Context, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), b.path)
+}
+
+// ConfigMapBackend persists the registry to a ConfigMap, which allows the
+// registry to survive the rescheduling of k8trics
+type ConfigMapBackend struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapBackend takes in the namespace and the name of a ConfigMap
+// and returns a backend which persists the registry to it, the ConfigMap
+// is created if it does not exist
+func NewConfigMapBackend(clientset kubernetes.Interface, namespace, name string) *ConfigMapBackend {
+	return &ConfigMapBackend{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (b *ConfigMapBackend) Load(ctx context.Context) ([]byte, error) {
+	cm, err := b.clientset.CoreV1().ConfigMaps(b.namespace).Get(ctx, b.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(cm.Data[configMapKey]), nil
+}
+
+func (b *ConfigMapBackend) Save(ctx context.Context, data []byte) error {
+	configMaps := b.clientset.CoreV1().ConfigMaps(b.namespace)
+
+	cm, err := configMaps.Get(ctx, b.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      b.name,
+				Namespace: b.namespace,
+				Labels:    map[string]string{"app": "k8trics"},
+			},
+			Data: map[string]string{configMapKey: string(data)},
+		}, metav1.CreateOptions{})
+
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapKey] = string(data)
+
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// memoryBackend does not persist the registry
+type memoryBackend struct{}
+
+func (memoryBackend) Load(ctx context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+func (memoryBackend) Save(ctx context.Context, data []byte) error {
+	return nil
+}
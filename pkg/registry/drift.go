@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// StateInSync means that the daemon runs the desired module
+	StateInSync = "in-sync"
+	// StateMissing means that the daemon should run the module but does not
+	StateMissing = "missing"
+	// StateDrifted means that the daemon runs a module which differs from
+	// the desired one
+	StateDrifted = "drifted"
+	// StateUnexpected means that the daemon runs the module but should not
+	StateUnexpected = "unexpected"
+	// StateUnknown means that the daemon could not be queried
+	StateUnknown = "unknown"
+)
+
+// everyNode is the node filter matching every daemon
+var everyNode = discovery.NodeFilter{}
+
+// NodeState is the state of a module on the daemon of a node compared to
+// the desired state of the module
+type NodeState struct {
+	Node  string `json:"node"`
+	Pod   string `json:"pod"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the actual state of a module on every daemon compared to the
+// desired state recorded in the registry
+type Status struct {
+	Module string `json:"module"`
+	// Desired is true if the module is recorded in the registry
+	Desired bool `json:"desired"`
+	// InSync is true if every daemon is in the desired state
+	InSync bool        `json:"inSync"`
+	Nodes  []NodeState `json:"nodes"`
+}
+
+// Inspect takes in the name of a module, queries the module on every
+// daemon and compares it with the desired state of the module
+//
+// The daemons which do not run the module and should not run it are left
+// out of the status
+func Inspect(ctx context.Context, registry *Registry, discovery *discovery.Discovery, fanout *fanout.Fanout, name string) *Status {
+	status := &Status{Module: name, Nodes: []NodeState{}}
+
+	entry, desired := registry.Get(name)
+	status.Desired = desired
+
+	targeted := map[string]struct{}{}
+	if desired {
+		for _, daemon := range discovery.Daemons() {
+			if !entry.Selects(daemon.Pod.Spec.NodeName) {
+				continue
+			}
+
+			targeted[daemon.Pod.GetName()] = struct{}{}
+		}
+	}
+
+	req := api.GetRequest{Core: &base.ModuleCore{Name: name}}
+	resp := fanout.Request(everyNode, func(conn *grpc.ClientConn) (interface{}, error) {
+		return rpc.HyperionGet(ctx, &req, conn)
+	})
+
+	for _, result := range resp.Results {
+		_, wanted := targeted[result.Pod]
+		state := NodeState{Node: result.Node, Pod: result.Pod}
+
+		switch {
+		case result.Code == codes.NotFound.String():
+			if !wanted {
+				continue
+			}
+			state.State = StateMissing
+		case result.Error != "":
+			state.State = StateUnknown
+			state.Error = result.Error
+		case !wanted:
+			state.State = StateUnexpected
+		case sameModule(entry.Module, result.Response):
+			state.State = StateInSync
+		default:
+			state.State = StateDrifted
+		}
+
+		status.Nodes = append(status.Nodes, state)
+	}
+
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Node < status.Nodes[j].Node
+	})
+
+	status.InSync = true
+	for _, node := range status.Nodes {
+		if node.State != StateInSync {
+			status.InSync = false
+		}
+	}
+
+	return status
+}
+
+// sameModule takes in the desired module and the response of a Get request
+// and returns true if the running module matches the desired one, the
+// fields managed by the daemon are ignored
+func sameModule(desired *base.Module, res interface{}) bool {
+	resp, ok := res.(*api.GetResponse)
+	if !ok {
+		return false
+	}
+
+	running := resp.GetModule()
+
+	return proto.Equal(desired.GetCore(), running.GetCore()) &&
+		proto.Equal(desired.GetMetadata(), running.GetMetadata()) &&
+		proto.Equal(desired.GetSpec(), running.GetSpec())
+}
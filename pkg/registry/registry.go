@@ -0,0 +1,275 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Entry is the desired state of a module, ie. the last applied version of
+// the module along with the set of nodes on which it should be running
+//
+// The node set is the union of the nodes targeted by the Apply requests
+// minus the nodes targeted by the Delete requests since
+type Entry struct {
+	Module *base.Module
+	// AllNodes is true if the module was applied to every node, including
+	// the nodes which join later, except for the Excluded ones
+	AllNodes bool
+	// Nodes are the names of the nodes on which the module should be
+	// running if it was not applied to every node
+	Nodes []string
+	// Excluded are the names of the nodes from which the module was
+	// deleted after it was applied to every node
+	Excluded []string
+}
+
+// Selects takes in the name of a node and returns true if the module
+// should be running on it
+func (e Entry) Selects(nodeName string) bool {
+	if e.AllNodes {
+		return !contains(e.Excluded, nodeName)
+	}
+
+	return contains(e.Nodes, nodeName)
+}
+
+// entryJSON is the serialized form of an entry, the module is serialized
+// with protojson as it is a protobuf message
+type entryJSON struct {
+	Module   json.RawMessage `json:"module"`
+	AllNodes bool            `json:"allNodes,omitempty"`
+	Nodes    []string        `json:"nodes,omitempty"`
+	Excluded []string        `json:"excluded,omitempty"`
+}
+
+// Registry keeps the desired state of the modules applied through k8trics
+// so that they can be applied again on the daemons which lost them, eg.
+// the restarted daemons or the daemons of new nodes
+//
+// Only the latest version of a module is kept, it is forgotten once the
+// module is deleted from every node it was applied to
+type Registry struct {
+	backend Backend
+	entries map[string]Entry
+
+	lock sync.RWMutex
+}
+
+// New takes in a backend and returns a new, empty, registry
+func New(backend Backend) *Registry {
+	return &Registry{
+		backend: backend,
+		entries: make(map[string]Entry),
+	}
+}
+
+// Load replaces the content of the registry with the one persisted by the
+// backend
+func (r *Registry) Load(ctx context.Context) error {
+	data, err := r.backend.Load(ctx)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	raw := map[string]entryJSON{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	entries := make(map[string]Entry, len(raw))
+	for name, item := range raw {
+		module := &base.Module{}
+		if err := protojson.Unmarshal(item.Module, module); err != nil {
+			return err
+		}
+
+		// An entry without any node is never saved, hence it was saved
+		// before the node sets were tracked and targeted every node
+		entries[name] = Entry{
+			Module:   module,
+			AllNodes: item.AllNodes || len(item.Nodes) == 0,
+			Nodes:    item.Nodes,
+			Excluded: item.Excluded,
+		}
+	}
+
+	r.lock.Lock()
+	r.entries = entries
+	r.lock.Unlock()
+
+	return nil
+}
+
+// Put takes in a module along with the node filter of the Apply request
+// and the daemons it targeted and records the module as the desired state,
+// the targeted nodes are added to the node set of the module
+func (r *Registry) Put(ctx context.Context, module *base.Module, filter discovery.NodeFilter, daemons []discovery.Daemon) error {
+	name := module.GetCore().GetName()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry := r.entries[name]
+	entry.Module = proto.Clone(module).(*base.Module)
+
+	switch nodes := nodeNames(filter, daemons); {
+	case filter.Empty():
+		entry.AllNodes, entry.Nodes, entry.Excluded = true, nil, nil
+	case entry.AllNodes:
+		entry.Excluded = subtract(entry.Excluded, nodes)
+	default:
+		entry.Nodes = union(entry.Nodes, nodes)
+	}
+
+	r.entries[name] = entry
+	return r.save(ctx)
+}
+
+// Delete takes in the name of a module along with the node filter of the
+// Delete request and the daemons it targeted and removes the targeted
+// nodes from the node set of the module, the module is forgotten once its
+// node set is empty
+//
+// Delete returns true if the module was forgotten
+func (r *Registry) Delete(ctx context.Context, name string, filter discovery.NodeFilter, daemons []discovery.Daemon) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry, ok := r.entries[name]
+	if !ok {
+		return false, nil
+	}
+
+	switch nodes := nodeNames(filter, daemons); {
+	case filter.Empty():
+		entry.AllNodes, entry.Nodes = false, nil
+	case entry.AllNodes:
+		entry.Excluded = union(entry.Excluded, nodes)
+	default:
+		entry.Nodes = subtract(entry.Nodes, nodes)
+	}
+
+	forgotten := !entry.AllNodes && len(entry.Nodes) == 0
+	if forgotten {
+		delete(r.entries, name)
+	} else {
+		r.entries[name] = entry
+	}
+
+	return forgotten, r.save(ctx)
+}
+
+// Get takes in the name of a module and returns its desired state
+func (r *Registry) Get(name string) (Entry, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.entries[name]
+	return entry, ok
+}
+
+// List returns the desired state of every module sorted by module name
+func (r *Registry) List() []Entry {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entries := make([]Entry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Module.GetCore().GetName() < entries[j].Module.GetCore().GetName()
+	})
+
+	return entries
+}
+
+// save persists the registry, the caller must hold the lock
+func (r *Registry) save(ctx context.Context) error {
+	raw := make(map[string]entryJSON, len(r.entries))
+	for name, entry := range r.entries {
+		module, err := protojson.Marshal(entry.Module)
+		if err != nil {
+			return err
+		}
+
+		raw[name] = entryJSON{
+			Module:   module,
+			AllNodes: entry.AllNodes,
+			Nodes:    entry.Nodes,
+			Excluded: entry.Excluded,
+		}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return r.backend.Save(ctx, data)
+}
+
+// nodeNames takes in the node filter of a request and the daemons it
+// targeted and returns the names of the targeted nodes
+//
+// The named nodes are kept even if their daemon is not known yet, while
+// the node selector can only be resolved through the targeted daemons
+func nodeNames(filter discovery.NodeFilter, daemons []discovery.Daemon) []string {
+	if filter.Selector == nil || filter.Selector.Empty() {
+		return filter.Names
+	}
+
+	names := []string{}
+	for _, daemon := range daemons {
+		names = append(names, daemon.Pod.Spec.NodeName)
+	}
+
+	return names
+}
+
+// union takes in two sets of node names and returns their sorted union
+func union(a, b []string) []string {
+	set := map[string]struct{}{}
+	for _, name := range append(append([]string{}, a...), b...) {
+		set[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// subtract takes in two sets of node names and returns the names of the
+// first set which are not in the second one
+func subtract(a, b []string) []string {
+	names := []string{}
+	for _, name := range a {
+		if !contains(b, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
+	"github.com/sagacious-labs/k8trics/pkg/rollout"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sagacious-labs/k8trics/pkg/tracker"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// replayBackoff is the backoff between the attempts to apply the modules
+// on a daemon, the daemon may not be resolvable as soon as its pod is
+// ready, eg. until it is added to the EndpointSlices
+var replayBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   2,
+	Steps:    6,
+}
+
+// replayTimeout bounds each Apply request of a replay
+const replayTimeout = 30 * time.Second
+
+// Replayer applies the desired modules on the daemons which become ready,
+// ie. the daemons of new nodes and the restarted daemons, as they do not
+// run any module
+type Replayer struct {
+	ctx       context.Context
+	registry  *Registry
+	tracker   *tracker.Tracker
+	discovery *discovery.Discovery
+	fanout    *fanout.Fanout
+}
+
+// NewReplayer returns a new instance of Replayer, the context bounds the
+// replays. It must be called before the tracker is started as it watches
+// the daemon pods becoming ready
+func NewReplayer(ctx context.Context, registry *Registry, tracker *tracker.Tracker, discovery *discovery.Discovery, fanout *fanout.Fanout) *Replayer {
+	r := &Replayer{
+		ctx:       ctx,
+		registry:  registry,
+		tracker:   tracker,
+		discovery: discovery,
+		fanout:    fanout,
+	}
+
+	tracker.OnPodReady(r.handlePodReady)
+
+	return r
+}
+
+func (r *Replayer) handlePodReady(pod store.K8tricsPod) {
+	// The daemons which are already running when k8trics starts still run
+	// their modules
+	if !r.tracker.Synced() || !r.discovery.Candidate(pod) {
+		return
+	}
+
+	go r.replay(pod)
+}
+
+// replay takes in a daemon pod and applies every desired module targeting
+// its node on it, the failed modules are retried with a backoff
+func (r *Replayer) replay(pod store.K8tricsPod) {
+	pending := r.registry.List()
+	if len(pending) == 0 {
+		return
+	}
+
+	nodeName := pod.Spec.NodeName
+	key := pod.GetNamespace() + "/" + pod.GetName()
+
+	resolved := false
+
+	err := wait.ExponentialBackoffWithContext(r.ctx, replayBackoff, func() (bool, error) {
+		daemon, ok := r.daemon(pod)
+		if !ok || daemon.Err != nil {
+			return false, nil
+		}
+		resolved = true
+
+		failed := []Entry{}
+
+		for _, entry := range pending {
+			if !entry.Selects(nodeName) {
+				continue
+			}
+
+			// Retrying cannot help a node without a release for its
+			// architecture
+			if plan := rollout.New(r.discovery, entry.Module, []discovery.Daemon{daemon}); len(plan.Targets) == 0 {
+				logrus.Debugf("skipped replaying module %s on %s: %s", entry.Module.GetCore().GetName(), key, plan.Unsupported[0].Err)
+				continue
+			}
+
+			req := api.ApplyRequest{Module: entry.Module}
+			ctx, cancel := context.WithTimeout(r.ctx, replayTimeout)
+			resp := r.fanout.RequestDaemons([]discovery.Daemon{daemon}, func(conn *grpc.ClientConn) (interface{}, error) {
+				return rpc.HyperionApply(ctx, &req, conn)
+			})
+			cancel()
+			if err := resp.Err(); err != nil {
+				logrus.Debugf("failed to replay module %s on %s: %s", entry.Module.GetCore().GetName(), key, err)
+				failed = append(failed, entry)
+				continue
+			}
+
+			logrus.Infof("Replayed module %s on %s", entry.Module.GetCore().GetName(), key)
+		}
+
+		pending = failed
+		return len(pending) == 0, nil
+	})
+
+	// Candidates which never showed up as a daemon are not daemons
+	if err == nil || !resolved {
+		return
+	}
+
+	for _, entry := range pending {
+		logrus.Warnf("failed to replay module %s on %s: %s", entry.Module.GetCore().GetName(), key, err)
+	}
+}
+
+// daemon takes in a pod and returns the daemon of the pod if the pod is a
+// daemon
+func (r *Replayer) daemon(pod store.K8tricsPod) (discovery.Daemon, bool) {
+	for _, daemon := range r.discovery.Daemons() {
+		if daemon.Pod.GetName() == pod.GetName() && daemon.Pod.GetNamespace() == pod.GetNamespace() {
+			return daemon, true
+		}
+	}
+
+	return discovery.Daemon{}, false
+}
@@ -0,0 +1,358 @@
+package release
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+)
+
+// verifiedTTL is how long a verified release is trusted without being
+// fetched again, it keeps the controller resyncs from refetching the
+// releases
+const verifiedTTL = 10 * time.Minute
+
+// ValidationError is returned when a release of a module fails the
+// verification, the module must not be applied
+type ValidationError struct {
+	Module string
+	// Releases are the reasons keyed by the architecture of the release
+	Releases map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	reasons := []string{}
+	for _, arch := range []string{ArchAMD64, ArchARM64, ""} {
+		if reason, ok := e.Releases[arch]; ok {
+			if arch == "" {
+				reasons = append(reasons, reason)
+				continue
+			}
+
+			reasons = append(reasons, fmt.Sprintf("%s: %s", arch, reason))
+		}
+	}
+
+	return fmt.Sprintf("release verification of module %s failed: %s", e.Module, strings.Join(reasons, "; "))
+}
+
+const (
+	// ArchAMD64 is the architecture of the linuxAMD64 release
+	ArchAMD64 = "linux/amd64"
+	// ArchARM64 is the architecture of the linuxARM64 release
+	ArchARM64 = "linux/arm64"
+)
+
+// Releases takes in a module and returns its releases keyed by the
+// architecture, the architectures without a release are left out
+func Releases(module *base.Module) map[string]*base.ModuleMetadata_Releases_ModuleRelease {
+	releases := map[string]*base.ModuleMetadata_Releases_ModuleRelease{}
+
+	if r := module.GetMetadata().GetRelease().GetLinuxAMD64(); r.GetLocation() != "" {
+		releases[ArchAMD64] = r
+	}
+
+	if r := module.GetMetadata().GetRelease().GetLinuxARM64(); r.GetLocation() != "" {
+		releases[ArchARM64] = r
+	}
+
+	return releases
+}
+
+// Config is the configuration of the release verification
+type Config struct {
+	// Enabled enables the verification, if it is disabled then the modules
+	// are forwarded to the daemons as they are
+	Enabled bool
+	// PublicKey is the path of the PEM encoded public key the detached
+	// signatures are verified against, no signatures are verified if it is
+	// empty
+	PublicKey string
+	// SignatureSuffix is appended to the location of a release to get the
+	// location of its detached signature
+	SignatureSuffix string
+	// Timeout is the timeout of fetching a release
+	Timeout time.Duration
+	// MaxBytes is the maximum size of a release
+	MaxBytes int64
+	// AllowLocal allows the file URLs and the plain paths as locations,
+	// they let the clients probe the filesystem of k8trics hence only the
+	// http(s) URLs are allowed by default
+	AllowLocal bool
+}
+
+// ConfigFromEnv reads the environmental variables and returns the release
+// verification configuration
+func ConfigFromEnv() Config {
+	return Config{
+		Enabled:         utils.GetEnv("K8TRICS_RELEASE_VERIFY", "false") == "true",
+		PublicKey:       utils.GetEnv("K8TRICS_RELEASE_PUBLIC_KEY", ""),
+		SignatureSuffix: utils.GetEnv("K8TRICS_RELEASE_SIGNATURE_SUFFIX", ".sig"),
+		Timeout:         utils.GetEnvDuration("K8TRICS_RELEASE_FETCH_TIMEOUT", 30*time.Second),
+		MaxBytes:        int64(utils.GetEnvInt("K8TRICS_RELEASE_MAX_BYTES", 64*1024*1024)),
+		AllowLocal:      utils.GetEnv("K8TRICS_RELEASE_ALLOW_LOCAL", "false") == "true",
+	}
+}
+
+// Verifier fetches the releases of the modules and verifies their SHA256
+// and, if a public key is configured, their detached signatures
+//
+// The locations must be http(s) URLs, file URLs and plain paths are only
+// allowed if AllowLocal is set
+type Verifier struct {
+	cfg       Config
+	client    *http.Client
+	publicKey crypto.PublicKey
+
+	// verified holds the expiry of the verified releases keyed by their
+	// location and SHA256
+	verified map[string]time.Time
+	lock     sync.Mutex
+}
+
+// New takes in the configuration and returns a new instance of Verifier
+func New(cfg Config) (*Verifier, error) {
+	v := &Verifier{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		verified: map[string]time.Time{},
+	}
+
+	if cfg.Enabled && cfg.PublicKey != "" {
+		key, err := loadPublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		v.publicKey = key
+	}
+
+	return v, nil
+}
+
+// Verify takes in a module and returns a *ValidationError if any of its
+// releases cannot be fetched or fails the verification, nil is returned
+// if the verification is disabled
+func (v *Verifier) Verify(ctx context.Context, module *base.Module) error {
+	if !v.cfg.Enabled {
+		return nil
+	}
+
+	verr := &ValidationError{
+		Module:   module.GetCore().GetName(),
+		Releases: map[string]string{},
+	}
+
+	releases := Releases(module)
+	if len(releases) == 0 {
+		verr.Releases[""] = "module has no releases"
+		return verr
+	}
+
+	for arch, release := range releases {
+		if err := v.verifyRelease(ctx, release); err != nil {
+			verr.Releases[arch] = err.Error()
+		}
+	}
+
+	if len(verr.Releases) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// verifyRelease takes in a release and verifies it
+func (v *Verifier) verifyRelease(ctx context.Context, release *base.ModuleMetadata_Releases_ModuleRelease) error {
+	expected := strings.ToLower(strings.TrimSpace(release.GetSha256()))
+	if expected == "" {
+		return errors.New("release has no sha256")
+	}
+
+	key := release.GetLocation() + "@" + expected
+	if v.cached(key) {
+		return nil
+	}
+
+	data, err := v.fetch(ctx, release.GetLocation())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("sha256 mismatch, expected %s but got %s", expected, actual)
+	}
+
+	if v.publicKey != nil {
+		signature, err := v.fetch(ctx, release.GetLocation()+v.cfg.SignatureSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature: %w", err)
+		}
+
+		if err := verifySignature(v.publicKey, data, signature); err != nil {
+			return err
+		}
+	}
+
+	v.store(key)
+	return nil
+}
+
+// fetch takes in a location and returns its content
+func (v *Verifier) fetch(ctx context.Context, location string) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location %q: %w", location, err)
+	}
+
+	var body io.ReadCloser
+
+	switch u.Scheme {
+	case "http", "https":
+		ctx, cancel := context.WithTimeout(ctx, v.cfg.Timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := v.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to fetch %s: %s", location, resp.Status)
+		}
+
+		body = resp.Body
+	case "file", "":
+		if !v.cfg.AllowLocal {
+			return nil, fmt.Errorf("local location %q is not allowed", location)
+		}
+
+		path := u.Path
+		if u.Scheme == "" {
+			path = location
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		body = file
+	default:
+		return nil, fmt.Errorf("unsupported location scheme %q", u.Scheme)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, v.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", location, err)
+	}
+
+	if int64(len(data)) > v.cfg.MaxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", location, v.cfg.MaxBytes)
+	}
+
+	return data, nil
+}
+
+func (v *Verifier) cached(key string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	expires, ok := v.verified[key]
+	return ok && time.Now().Before(expires)
+}
+
+func (v *Verifier) store(key string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	now := time.Now()
+	for k, expires := range v.verified {
+		if now.After(expires) {
+			delete(v.verified, k)
+		}
+	}
+
+	v.verified[key] = now.Add(verifiedTTL)
+}
+
+// loadPublicKey takes in the path of a PEM encoded PKIX public key and
+// returns the key, ed25519, ECDSA and RSA keys are supported
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", key, path)
+	}
+}
+
+// verifySignature takes in a public key, the signed data and the detached
+// signature, which may be raw or base64 encoded, and verifies it
+//
+// ed25519 signs the data itself while ECDSA (ASN.1) and RSA (PKCS #1 v1.5)
+// sign its SHA256
+func verifySignature(key crypto.PublicKey, data, signature []byte) error {
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err == nil {
+		signature = decoded
+	}
+
+	digest := sha256.Sum256(data)
+	valid := false
+
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, data, signature)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !valid {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,307 @@
+package release
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+)
+
+var payload = []byte("\x7fELF hyperion module")
+
+// newServer takes in the files keyed by their path and returns a server
+// serving them
+func newServer(t *testing.T, files map[string][]byte) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newModule takes in the location of the amd64 release and its SHA256 and
+// returns the module
+func newModule(location, sum string) *base.Module {
+	return &base.Module{
+		Core: &base.ModuleCore{Name: "tcp-rtt"},
+		Metadata: &base.ModuleMetadata{
+			Release: &base.ModuleMetadata_Releases{
+				LinuxAMD64: &base.ModuleMetadata_Releases_ModuleRelease{Location: location, Sha256: sum},
+			},
+		},
+	}
+}
+
+// sha256Hex takes in data and returns its hex encoded SHA256
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writePublicKey takes in a public key and returns the path of the file
+// holding it PEM encoded
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "release.pub")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	return path
+}
+
+// newVerifier takes in the configuration and returns the verifier with
+// the defaults of the configuration filled in
+func newVerifier(t *testing.T, cfg Config) *Verifier {
+	t.Helper()
+
+	cfg.Enabled = true
+	if cfg.SignatureSuffix == "" {
+		cfg.SignatureSuffix = ".sig"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = 1024
+	}
+
+	v, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return v
+}
+
+// verify takes in a verifier and a module and returns the reason the amd64
+// release failed the verification, empty if it passed
+func verify(t *testing.T, v *Verifier, module *base.Module) string {
+	t.Helper()
+
+	err := v.Verify(context.Background(), module)
+	if err == nil {
+		return ""
+	}
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Verify() error = %v, want a *ValidationError", err)
+	}
+
+	return verr.Releases[ArchAMD64]
+}
+
+func TestVerifySHA256(t *testing.T) {
+	server := newServer(t, map[string][]byte{"/module": payload})
+	v := newVerifier(t, Config{})
+
+	if reason := verify(t, v, newModule(server.URL+"/module", sha256Hex(payload))); reason != "" {
+		t.Errorf("Verify() = %s, want the release verified", reason)
+	}
+
+	if reason := verify(t, v, newModule(server.URL+"/module", strings.ToUpper(sha256Hex(payload)))); reason != "" {
+		t.Errorf("Verify() = %s, want the sha256 compared case insensitively", reason)
+	}
+
+	if reason := verify(t, v, newModule(server.URL+"/module", sha256Hex([]byte("other")))); !strings.Contains(reason, "sha256 mismatch") {
+		t.Errorf("Verify() = %q, want a sha256 mismatch", reason)
+	}
+
+	if reason := verify(t, v, newModule(server.URL+"/module", "")); !strings.Contains(reason, "no sha256") {
+		t.Errorf("Verify() = %q, want the missing sha256 rejected", reason)
+	}
+
+	if reason := verify(t, v, newModule(server.URL+"/missing", sha256Hex(payload))); !strings.Contains(reason, "404") {
+		t.Errorf("Verify() = %q, want the missing release rejected", reason)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+
+	keys := []struct {
+		name   string
+		public crypto.PublicKey
+		sign   func(data []byte) ([]byte, error)
+	}{
+		{
+			name:   "ed25519",
+			public: edPublic,
+			sign: func(data []byte) ([]byte, error) {
+				return ed25519.Sign(edPrivate, data), nil
+			},
+		},
+		{
+			name:   "ecdsa",
+			public: &ecPrivate.PublicKey,
+			sign: func(data []byte) ([]byte, error) {
+				digest := sha256.Sum256(data)
+				return ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+			},
+		},
+		{
+			name:   "rsa",
+			public: &rsaPrivate.PublicKey,
+			sign: func(data []byte) ([]byte, error) {
+				digest := sha256.Sum256(data)
+				return rsa.SignPKCS1v15(rand.Reader, rsaPrivate, crypto.SHA256, digest[:])
+			},
+		},
+	}
+
+	// The tampered payload matches its SHA256, only its signature can
+	// reject it
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	for _, key := range keys {
+		signature, err := key.sign(payload)
+		if err != nil {
+			t.Fatalf("%s: sign() error = %v", key.name, err)
+		}
+
+		server := newServer(t, map[string][]byte{
+			"/module":         payload,
+			"/module.sig":     signature,
+			"/module-b64":     payload,
+			"/module-b64.sig": []byte(base64.StdEncoding.EncodeToString(signature) + "\n"),
+			"/tampered":       tampered,
+			"/tampered.sig":   signature,
+			"/unsigned":       payload,
+		})
+		v := newVerifier(t, Config{PublicKey: writePublicKey(t, key.public)})
+
+		tests := []struct {
+			name   string
+			path   string
+			sum    string
+			reason string
+		}{
+			{name: "valid", path: "/module", sum: sha256Hex(payload)},
+			{name: "valid base64", path: "/module-b64", sum: sha256Hex(payload)},
+			{name: "tampered payload", path: "/tampered", sum: sha256Hex(tampered), reason: "invalid signature"},
+			{name: "missing signature", path: "/unsigned", sum: sha256Hex(payload), reason: "failed to fetch signature"},
+		}
+
+		for _, tt := range tests {
+			t.Run(key.name+"/"+tt.name, func(t *testing.T) {
+				reason := verify(t, v, newModule(server.URL+tt.path, tt.sum))
+				if tt.reason == "" && reason != "" {
+					t.Errorf("Verify() = %s, want the release verified", reason)
+				}
+				if tt.reason != "" && !strings.Contains(reason, tt.reason) {
+					t.Errorf("Verify() = %q, want %q", reason, tt.reason)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyMaxBytes(t *testing.T) {
+	large := []byte(strings.Repeat("x", 1025))
+	server := newServer(t, map[string][]byte{
+		"/limit": large[:1024],
+		"/large": large,
+	})
+	v := newVerifier(t, Config{MaxBytes: 1024})
+
+	if reason := verify(t, v, newModule(server.URL+"/limit", sha256Hex(large[:1024]))); reason != "" {
+		t.Errorf("Verify() = %s, want a release of MaxBytes verified", reason)
+	}
+
+	if reason := verify(t, v, newModule(server.URL+"/large", sha256Hex(large))); !strings.Contains(reason, "larger than 1024 bytes") {
+		t.Errorf("Verify() = %q, want a release over MaxBytes rejected", reason)
+	}
+}
+
+func TestVerifyLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "module")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		location   string
+		allowLocal bool
+		reason     string
+	}{
+		{name: "file url", location: "file://" + path, reason: "is not allowed"},
+		{name: "plain path", location: path, reason: "is not allowed"},
+		{name: "file url allowed", location: "file://" + path, allowLocal: true},
+		{name: "plain path allowed", location: path, allowLocal: true},
+		{name: "unsupported scheme", location: "ftp://example.com/module", allowLocal: true, reason: "unsupported location scheme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerifier(t, Config{AllowLocal: tt.allowLocal})
+
+			reason := verify(t, v, newModule(tt.location, sha256Hex(payload)))
+			if tt.reason == "" && reason != "" {
+				t.Errorf("Verify() = %s, want the release verified", reason)
+			}
+			if tt.reason != "" && !strings.Contains(reason, tt.reason) {
+				t.Errorf("Verify() = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyDisabled(t *testing.T) {
+	v, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := v.Verify(context.Background(), newModule("ftp://example.com/module", "")); err != nil {
+		t.Errorf("Verify() error = %v, want nil when disabled", err)
+	}
+}
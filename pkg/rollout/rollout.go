@@ -0,0 +1,192 @@
+package rollout
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sagacious-labs/k8trics/pkg/discovery"
+	"github.com/sagacious-labs/k8trics/pkg/fanout"
+	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/base"
+	"github.com/sagacious-labs/k8trics/pkg/release"
+	"github.com/sagacious-labs/k8trics/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// unknownPlatform is the platform of the nodes whose architecture cannot
+// be looked up
+const unknownPlatform = "unknown"
+
+// Policy decides what happens to the daemons running on a node whose
+// architecture has no release of the module
+type Policy string
+
+const (
+	// PolicySkip does not contact the daemons and reports their nodes as
+	// skipped
+	PolicySkip Policy = "skip"
+	// PolicyFail does not contact the daemons and reports their nodes as
+	// failed
+	PolicyFail Policy = "fail"
+)
+
+// ParsePolicy takes in the name of a policy and returns the policy
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case PolicySkip, PolicyFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid unsupported architecture policy %q", name)
+	}
+}
+
+// PolicyFromEnv reads the default policy from K8TRICS_UNSUPPORTED_ARCH
+func PolicyFromEnv() Policy {
+	policy, err := ParsePolicy(utils.GetEnv("K8TRICS_UNSUPPORTED_ARCH", string(PolicySkip)))
+	if err != nil {
+		logrus.Warnf("%s, using %s", err, PolicySkip)
+		return PolicySkip
+	}
+
+	return policy
+}
+
+// Unsupported is a daemon running on a node whose architecture has no
+// release of the module
+type Unsupported struct {
+	Daemon discovery.Daemon
+	// Platform is the platform of the node, empty if it could not be
+	// looked up
+	Platform string
+	Err      error
+}
+
+// Coverage is the outcome of a rollout on the nodes of an architecture
+type Coverage struct {
+	Platform string `json:"platform"`
+	// Release is true if the module has a release for the platform
+	Release   bool `json:"release"`
+	Nodes     int  `json:"nodes"`
+	Succeeded int  `json:"succeeded"`
+	Failed    int  `json:"failed"`
+	Skipped   int  `json:"skipped"`
+}
+
+// Plan splits the daemons targeted by an Apply into the ones which can
+// run the module, ie. whose node architecture has a release of it, and
+// the ones which cannot
+//
+// A module without any release, eg. one whose releases are not managed by
+// k8trics, can run on every daemon
+type Plan struct {
+	Targets     []discovery.Daemon
+	Unsupported []Unsupported
+
+	releases map[string]bool
+	// platforms are the platforms of the daemons keyed by the pod
+	platforms map[string]string
+}
+
+// New takes in the discovery, the module and the targeted daemons and
+// returns the rollout plan of the module
+func New(discovery *discovery.Discovery, module *base.Module, daemons []discovery.Daemon) *Plan {
+	p := &Plan{
+		releases:  map[string]bool{},
+		platforms: map[string]string{},
+	}
+
+	for platform := range release.Releases(module) {
+		p.releases[platform] = true
+	}
+
+	for _, daemon := range daemons {
+		platform, err := discovery.Platform(daemon.Pod.Spec.NodeName)
+		if err != nil {
+			platform = unknownPlatform
+		}
+		p.platforms[podKey(daemon)] = platform
+
+		switch {
+		case len(p.releases) == 0 || p.releases[platform]:
+			p.Targets = append(p.Targets, daemon)
+		case err != nil:
+			p.Unsupported = append(p.Unsupported, Unsupported{Daemon: daemon, Err: err})
+		default:
+			p.Unsupported = append(p.Unsupported, Unsupported{
+				Daemon:   daemon,
+				Platform: platform,
+				Err:      fmt.Errorf("module has no release for %s", platform),
+			})
+		}
+	}
+
+	return p
+}
+
+// Empty returns true if the module cannot run on any of the daemons
+// because of their architecture
+func (p *Plan) Empty() bool {
+	return len(p.Targets) == 0 && len(p.Unsupported) > 0
+}
+
+// Report takes in the result of the Apply on the targets and the policy,
+// records the unsupported daemons in the result according to the policy
+// and returns the coverage of every platform
+func (p *Plan) Report(result *fanout.Result, policy Policy) []Coverage {
+	coverage := map[string]*Coverage{}
+	platform := func(name string) *Coverage {
+		if _, ok := coverage[name]; !ok {
+			coverage[name] = &Coverage{Platform: name, Release: len(p.releases) == 0 || p.releases[name]}
+		}
+
+		return coverage[name]
+	}
+
+	for name := range p.releases {
+		platform(name)
+	}
+
+	nodes := map[string]string{}
+	for _, daemon := range p.Targets {
+		nodes[daemon.Pod.Spec.NodeName] = p.platforms[podKey(daemon)]
+	}
+
+	for _, res := range result.Results {
+		c := platform(nodes[res.Node])
+		c.Nodes++
+
+		if res.Error == "" {
+			c.Succeeded++
+		} else {
+			c.Failed++
+		}
+	}
+
+	for _, unsupported := range p.Unsupported {
+		c := platform(p.platforms[podKey(unsupported.Daemon)])
+		c.Nodes++
+
+		if policy == PolicyFail {
+			result.Fail(unsupported.Daemon, unsupported.Err)
+			c.Failed++
+			continue
+		}
+
+		result.Skip(unsupported.Daemon)
+		c.Skipped++
+	}
+
+	report := make([]Coverage, 0, len(coverage))
+	for _, c := range coverage {
+		report = append(report, *c)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Platform < report[j].Platform
+	})
+
+	return report
+}
+
+func podKey(daemon discovery.Daemon) string {
+	return daemon.Pod.GetNamespace() + "/" + daemon.Pod.GetName()
+}
@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"net"
+	"sync"
+
+	"github.com/sagacious-labs/k8trics/pkg/certs"
+	"github.com/sagacious-labs/k8trics/pkg/store"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+)
+
+// Pool is a connection manager which maintains one long lived gRPC
+// client connection per hyperion daemon endpoint
+//
+// Connections are created lazily on the first request to an endpoint
+// and are reused by every subsequent request until they are explicitly
+// closed, usually when the daemon pod is deleted
+//
+// With TLS a connection is only reused for the server name it was verified
+// against, as the endpoint of a deleted daemon may be taken over by
+// another one
+type Pool struct {
+	conns map[string]*grpc.ClientConn
+	// serverNames are the TLS server names of the connections keyed by
+	// the endpoint
+	serverNames map[string]string
+
+	// tls is nil if the connections are in plaintext
+	tls *certs.Client
+
+	lock sync.Mutex
+}
+
+// NewPool takes in the TLS configuration of the connections and returns a
+// new instance of the connection pool, the connections are in plaintext
+// if the TLS configuration is nil
+func NewPool(tls *certs.Client) *Pool {
+	return &Pool{
+		conns:       make(map[string]*grpc.ClientConn),
+		serverNames: make(map[string]string),
+		tls:         tls,
+	}
+}
+
+// Get takes in an endpoint and the daemon pod serving it and returns the
+// connection associated with it, if no connection exists for the endpoint
+// then a new one is created
+//
+// With TLS the certificate of the daemon is verified against the server
+// name derived from the identity of the pod, the connection is replaced if
+// it was created for another server name
+//
+// The dial is non-blocking, the connection will be established in the
+// background and will be reconnected by gRPC in case of transient failures
+func (p *Pool) Get(endpoint string, pod store.K8tricsPod) (*grpc.ClientConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	serverName := ""
+	if p.tls != nil {
+		serverName = p.tls.ServerName(pod)
+	}
+
+	if conn, ok := p.conns[endpoint]; ok {
+		if conn.GetState() != connectivity.Shutdown && p.serverNames[endpoint] == serverName {
+			return conn, nil
+		}
+
+		if err := conn.Close(); err != nil {
+			logrus.Debugf("failed to close connection for endpoint %s: %s", endpoint, err)
+		}
+	}
+
+	creds := grpc.WithInsecure()
+	if p.tls != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(p.tls.TLSConfig(serverName)))
+	}
+
+	conn, err := grpc.Dial(endpoint, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Debugln("Created connection for endpoint: ", endpoint)
+	p.conns[endpoint] = conn
+	p.serverNames[endpoint] = serverName
+	return conn, nil
+}
+
+// Close takes in an endpoint and closes the connection associated with it
+// if there is one
+func (p *Pool) Close(endpoint string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	conn, ok := p.conns[endpoint]
+	if !ok {
+		return
+	}
+
+	if err := conn.Close(); err != nil {
+		logrus.Warnf("failed to close connection for endpoint %s: %s", endpoint, err)
+	}
+
+	logrus.Debugln("Closed connection for endpoint: ", endpoint)
+	delete(p.conns, endpoint)
+	delete(p.serverNames, endpoint)
+}
+
+// CloseHost takes in a host and closes every connection to that host
+// regardless of the port, it is used to drop the connections to a pod
+// when the pod goes away
+func (p *Pool) CloseHost(host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for endpoint, conn := range p.conns {
+		if h, _, err := net.SplitHostPort(endpoint); err != nil || h != host {
+			continue
+		}
+
+		if err := conn.Close(); err != nil {
+			logrus.Warnf("failed to close connection for endpoint %s: %s", endpoint, err)
+		}
+
+		logrus.Debugln("Closed connection for endpoint: ", endpoint)
+		delete(p.conns, endpoint)
+		delete(p.serverNames, endpoint)
+	}
+}
+
+// CloseAll closes every connection held by the pool
+func (p *Pool) CloseAll() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for endpoint, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			logrus.Warnf("failed to close connection for endpoint %s: %s", endpoint, err)
+		}
+
+		delete(p.conns, endpoint)
+		delete(p.serverNames, endpoint)
+	}
+}
+
+// State takes in an endpoint and returns the connectivity state of the
+// connection associated with it
+//
+// If no connection exists for the endpoint then connectivity.Idle is
+// returned as a connection will be created on the first request
+func (p *Pool) State(endpoint string) connectivity.State {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	conn, ok := p.conns[endpoint]
+	if !ok {
+		return connectivity.Idle
+	}
+
+	return conn.GetState()
+}
+
+// States returns the connectivity state of every connection held by the
+// pool keyed by the endpoint
+func (p *Pool) States() map[string]connectivity.State {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	states := make(map[string]connectivity.State, len(p.conns))
+	for endpoint, conn := range p.conns {
+		states[endpoint] = conn.GetState()
+	}
+
+	return states
+}
+
+// Healthy takes in an endpoint and returns true if the connection to the
+// endpoint is usable or can be created
+//
+// Connections which are failing or have been shut down are reported as
+// unhealthy so that the callers can skip the dead daemons
+func (p *Pool) Healthy(endpoint string) bool {
+	switch p.State(endpoint) {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
@@ -4,12 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 
+	"github.com/sagacious-labs/k8trics/pkg/enrich"
 	"github.com/sagacious-labs/k8trics/pkg/protos/v1alpha1/api"
 	"github.com/sagacious-labs/k8trics/pkg/store"
-	"github.com/sagacious-labs/k8trics/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 )
@@ -17,15 +16,14 @@ import (
 // WatchDataResponse represents the response of the watch RPCs
 type WatchDataResponse struct {
 	Data map[string]interface{} `json:"data,omitempty"`
+
+	// Pod is the pod which produced the data, it is used to filter the
+	// data and is never sent to the clients
+	Pod *store.K8tricsPod `json:"-"`
 }
 
 // HyperionApply is a wrapper around hyperion's `Apply` RPC
-func HyperionApply(ctx context.Context, req *api.ApplyRequest, host string) (*api.ApplyResponse, error) {
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
+func HyperionApply(ctx context.Context, req *api.ApplyRequest, conn *grpc.ClientConn) (*api.ApplyResponse, error) {
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.Apply(ctx, req)
 	if err != nil {
@@ -36,12 +34,7 @@ func HyperionApply(ctx context.Context, req *api.ApplyRequest, host string) (*ap
 }
 
 // HyperionDelete is a wrapper around hyperion's `Delete` RPC
-func HyperionDelete(ctx context.Context, req *api.DeleteRequest, host string) (*api.DeleteResponse, error) {
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
+func HyperionDelete(ctx context.Context, req *api.DeleteRequest, conn *grpc.ClientConn) (*api.DeleteResponse, error) {
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.Delete(ctx, req)
 	if err != nil {
@@ -52,12 +45,7 @@ func HyperionDelete(ctx context.Context, req *api.DeleteRequest, host string) (*
 }
 
 // HyperionGet is a wrapper around hyperion's `Get` RPC
-func HyperionGet(ctx context.Context, req *api.GetRequest, host string) (*api.GetResponse, error) {
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
+func HyperionGet(ctx context.Context, req *api.GetRequest, conn *grpc.ClientConn) (*api.GetResponse, error) {
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.Get(ctx, req)
 	if err != nil {
@@ -68,12 +56,7 @@ func HyperionGet(ctx context.Context, req *api.GetRequest, host string) (*api.Ge
 }
 
 // HyperionList is a wrapper around hyperion's `List` RPC
-func HyperionList(ctx context.Context, req *api.ListRequest, host string) (chan *api.GetResponse, error) {
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
+func HyperionList(ctx context.Context, req *api.ListRequest, conn *grpc.ClientConn) (chan *api.GetResponse, error) {
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.List(ctx, req)
 	if err != nil {
@@ -83,109 +66,114 @@ func HyperionList(ctx context.Context, req *api.ListRequest, host string) (chan
 	ch := make(chan *api.GetResponse, 8)
 
 	go func() {
+		defer close(ch)
+
 		for {
 			item, err := res.Recv()
-			if err == io.EOF {
-				close(ch)
-				return
-			}
 			if err != nil {
-				fmt.Println("[List Error]: ", err)
-				continue
+				if err != io.EOF && ctx.Err() == nil {
+					logrus.Warn("list stream failed: ", err)
+				}
+
+				return
 			}
 
-			ch <- item
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return ch, nil
 }
 
+// StreamErr returns the error which broke a stream once the channel of
+// the stream is closed, it returns nil if the daemon ended the stream or
+// if the stream was cancelled
+type StreamErr func() error
+
 // HyperionWatchData is a wrapper around hyperion's `WatchData` RPC
-func HyperionWatchData(ctx context.Context, req *api.WatchDataRequest, host string) (chan *WatchDataResponse, error) {
-	store, ok := ctx.Value("pod_store").(*store.PodStore)
+func HyperionWatchData(ctx context.Context, req *api.WatchDataRequest, conn *grpc.ClientConn) (chan *WatchDataResponse, StreamErr, error) {
+	enricher, ok := ctx.Value("enricher").(*enrich.Enricher)
 	if !ok {
-		return nil, errors.New("pod store not found")
-	}
-
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
+		return nil, nil, errors.New("enricher not found")
 	}
 
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.WatchData(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ch := make(chan *WatchDataResponse, 8)
+	var streamErr error
 
 	go func() {
+		defer close(ch)
+
 		for {
 			item, err := res.Recv()
 			if err != nil {
-				if err == io.EOF {
-					close(ch)
+				if err != io.EOF && ctx.Err() == nil {
+					streamErr = err
 				}
 
 				return
 			}
 
 			data := parseWatchDataJSON(item.Data)
-			cid, ok := data["container_id"].(string)
-			if !ok {
-				logrus.Warn("container_id not found in the retrieved data")
-				continue
-			}
-
-			pod, ok := store.GetByContainerID(cid)
-			if !ok {
-				logrus.Warn("no pod found for container id: ", cid)
+			pod, err := enricher.Enrich(data)
+			if err != nil {
+				logrus.Warn(err)
 				continue
 			}
-			data["name"] = utils.TrimPodTemplateHash(&pod.Pod)
 
-			ch <- &WatchDataResponse{
-				Data: data,
+			select {
+			case ch <- &WatchDataResponse{Data: data, Pod: pod}:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 
-	return ch, nil
+	return ch, func() error { return streamErr }, nil
 }
 
 // HyperionWatchLog is a wrapper around hyperion's `WatchLog` RPC
-func HyperionWatchLog(ctx context.Context, req *api.WatchLogRequest, host string) (chan string, error) {
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
+func HyperionWatchLog(ctx context.Context, req *api.WatchLogRequest, conn *grpc.ClientConn) (chan string, StreamErr, error) {
 	client := api.NewHyperionAPIServiceClient(conn)
 	res, err := client.WatchLog(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ch := make(chan string, 8)
+	var streamErr error
 
 	go func() {
+		defer close(ch)
+
 		for {
 			item, err := res.Recv()
 			if err != nil {
-				if err == io.EOF {
-					close(ch)
+				if err != io.EOF && ctx.Err() == nil {
+					streamErr = err
 				}
 
 				return
 			}
 
-			ch <- parseWatchLog(item.Data)
+			select {
+			case ch <- parseWatchLog(item.Data):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
-	return ch, nil
+	return ch, func() error { return streamErr }, nil
 }
 
 // parseWatchDataJSON takes in a slice of byte and converts it into
@@ -10,9 +10,17 @@ import (
 )
 
 // PodStore is an in memory store for storing pod info
+//
+// Along with the pods the store maintains secondary indexes for container
+// ID and label lookups which are updated together with the pods
 type PodStore struct {
 	internal map[string]K8tricsPod
 
+	// containers maps normalised container IDs to pod keys
+	containers map[string]string
+	// labels maps label key and value to the set of pod keys
+	labels map[string]map[string]map[string]struct{}
+
 	lock sync.RWMutex
 }
 
@@ -20,7 +28,9 @@ type PodStore struct {
 // be used to store pod info in memory
 func New() *PodStore {
 	return &PodStore{
-		internal: make(map[string]K8tricsPod),
+		internal:   make(map[string]K8tricsPod),
+		containers: make(map[string]string),
+		labels:     make(map[string]map[string]map[string]struct{}),
 	}
 }
 
@@ -29,8 +39,17 @@ func (ps *PodStore) Upsert(pod v1.Pod) {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
-	logrus.Println("Found pod with containers: ", (K8tricsPod{pod}).ContainerIDs())
-	ps.internal[fmt.Sprintf("%s.%s", pod.GetNamespace(), pod.GetName())] = K8tricsPod{pod}
+	kpod := K8tricsPod{pod}
+	key := generateKey(pod.GetNamespace(), pod.GetName())
+
+	logrus.Debugln("Found pod with containers: ", kpod.ContainerIDs())
+
+	if existing, ok := ps.internal[key]; ok {
+		ps.unindex(key, existing)
+	}
+
+	ps.internal[key] = kpod
+	ps.index(key, kpod)
 }
 
 // Get takes in name and namespace of a pod and returns the pod
@@ -43,11 +62,35 @@ func (ps *PodStore) Get(name, namespace string) (K8tricsPod, bool) {
 }
 
 // GetByLabels and returns all of the pods which have the label attached
+//
+// The lookup starts from the smallest set of pods matching any single
+// label and only checks the remaining labels against that set
 func (ps *PodStore) GetByLabels(labels map[string]string) (pods []K8tricsPod) {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
 
-	for _, pod := range ps.internal {
+	if len(labels) == 0 {
+		for _, pod := range ps.internal {
+			pods = append(pods, pod)
+		}
+
+		return
+	}
+
+	var candidates map[string]struct{}
+	for k, v := range labels {
+		keys := ps.labels[k][v]
+		if len(keys) == 0 {
+			return nil
+		}
+
+		if candidates == nil || len(keys) < len(candidates) {
+			candidates = keys
+		}
+	}
+
+	for key := range candidates {
+		pod := ps.internal[key]
 		if compareLabels(labels, pod.GetLabels()) {
 			pods = append(pods, pod)
 		}
@@ -57,26 +100,24 @@ func (ps *PodStore) GetByLabels(labels map[string]string) (pods []K8tricsPod) {
 }
 
 // GetByContainerID takes in a container ID and returns the pod that is running the container
+//
+// The container ID can be passed with or without the container runtime
+// prefix, eg. "containerd://<id>" and "<id>" are treated the same
 func (ps *PodStore) GetByContainerID(containerID string) (*K8tricsPod, bool) {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
 
-	for _, pod := range ps.internal {
-		for _, id := range pod.ContainerIDs() {
-			splitted := strings.Split(id, "://")
-			if len(splitted) != 2 {
-				continue
-			}
-
-			id = splitted[1]
+	key, ok := ps.containers[normaliseContainerID(containerID)]
+	if !ok {
+		return nil, false
+	}
 
-			if id == containerID {
-				return &pod, true
-			}
-		}
+	pod, ok := ps.internal[key]
+	if !ok {
+		return nil, false
 	}
 
-	return nil, false
+	return &pod, true
 }
 
 // Delete takes in a name and namespace of a pod and deletes the
@@ -85,7 +126,63 @@ func (ps *PodStore) Delete(name, namespace string) {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
-	delete(ps.internal, generateKey(namespace, name))
+	key := generateKey(namespace, name)
+	if existing, ok := ps.internal[key]; ok {
+		ps.unindex(key, existing)
+	}
+
+	delete(ps.internal, key)
+}
+
+// index adds the pod to the secondary indexes of the store
+//
+// The caller must hold the write lock
+func (ps *PodStore) index(key string, pod K8tricsPod) {
+	for _, id := range pod.ContainerIDs() {
+		if id = normaliseContainerID(id); id != "" {
+			ps.containers[id] = key
+		}
+	}
+
+	for k, v := range pod.GetLabels() {
+		values, ok := ps.labels[k]
+		if !ok {
+			values = make(map[string]map[string]struct{})
+			ps.labels[k] = values
+		}
+
+		keys, ok := values[v]
+		if !ok {
+			keys = make(map[string]struct{})
+			values[v] = keys
+		}
+
+		keys[key] = struct{}{}
+	}
+}
+
+// unindex removes the pod from the secondary indexes of the store
+//
+// The caller must hold the write lock
+func (ps *PodStore) unindex(key string, pod K8tricsPod) {
+	for _, id := range pod.ContainerIDs() {
+		id = normaliseContainerID(id)
+		if ps.containers[id] == key {
+			delete(ps.containers, id)
+		}
+	}
+
+	for k, v := range pod.GetLabels() {
+		keys := ps.labels[k][v]
+		delete(keys, key)
+
+		if len(keys) == 0 {
+			delete(ps.labels[k], v)
+		}
+		if len(ps.labels[k]) == 0 {
+			delete(ps.labels, k)
+		}
+	}
 }
 
 // compareLabels takes in a "from" labels and "with" labels
@@ -107,3 +204,14 @@ func compareLabels(from, with map[string]string) bool {
 func generateKey(namespace, name string) string {
 	return fmt.Sprintf("%s.%s", namespace, name)
 }
+
+// normaliseContainerID takes in a container ID as reported in the pod
+// status and strips the container runtime prefix, eg. "containerd://"
+// or "docker://", from it
+func normaliseContainerID(id string) string {
+	if idx := strings.Index(id, "://"); idx != -1 {
+		return id[idx+len("://"):]
+	}
+
+	return id
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPod takes in the name of a pod, its labels and its container IDs and
+// returns a pod in the default namespace
+func newPod(name string, labels map[string]string, containerIDs ...string) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    labels,
+		},
+	}
+
+	for i, id := range containerIDs {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{
+			Name:        fmt.Sprintf("c%d", i),
+			ContainerID: id,
+		})
+	}
+
+	return pod
+}
+
+func TestGetByContainerIDNormalisesPrefix(t *testing.T) {
+	ps := New()
+	ps.Upsert(newPod("containerd", nil, "containerd://aaa"))
+	ps.Upsert(newPod("docker", nil, "docker://bbb"))
+	ps.Upsert(newPod("bare", nil, "ccc"))
+
+	tests := []struct {
+		containerID string
+		pod         string
+	}{
+		{"containerd://aaa", "containerd"},
+		{"aaa", "containerd"},
+		{"docker://aaa", "containerd"},
+		{"docker://bbb", "docker"},
+		{"bbb", "docker"},
+		{"containerd://ccc", "bare"},
+		{"ccc", "bare"},
+	}
+
+	for _, tt := range tests {
+		pod, ok := ps.GetByContainerID(tt.containerID)
+		if !ok {
+			t.Errorf("GetByContainerID(%q) found no pod, want %s", tt.containerID, tt.pod)
+			continue
+		}
+
+		if pod.GetName() != tt.pod {
+			t.Errorf("GetByContainerID(%q) = %s, want %s", tt.containerID, pod.GetName(), tt.pod)
+		}
+	}
+
+	if _, ok := ps.GetByContainerID("containerd://ddd"); ok {
+		t.Errorf("GetByContainerID found a pod for an unknown container")
+	}
+}
+
+func TestContainerName(t *testing.T) {
+	pod := K8tricsPod{newPod("pod", nil, "containerd://aaa", "docker://bbb")}
+
+	for id, want := range map[string]string{"aaa": "c0", "containerd://bbb": "c1"} {
+		if name, ok := pod.ContainerName(id); !ok || name != want {
+			t.Errorf("ContainerName(%q) = %q, %v, want %q", id, name, ok, want)
+		}
+	}
+}
+
+func TestUpsertReplaceCleansIndexes(t *testing.T) {
+	ps := New()
+	ps.Upsert(newPod("pod", map[string]string{"app": "web", "tier": "frontend"}, "containerd://old"))
+	ps.Upsert(newPod("pod", map[string]string{"app": "api"}, "containerd://new"))
+
+	if _, ok := ps.GetByContainerID("old"); ok {
+		t.Errorf("replaced container is still indexed")
+	}
+	if _, ok := ps.GetByContainerID("new"); !ok {
+		t.Errorf("new container is not indexed")
+	}
+
+	if pods := ps.GetByLabels(map[string]string{"app": "web"}); len(pods) != 0 {
+		t.Errorf("GetByLabels(app=web) = %d pods, want 0", len(pods))
+	}
+	if pods := ps.GetByLabels(map[string]string{"app": "api"}); len(pods) != 1 {
+		t.Errorf("GetByLabels(app=api) = %d pods, want 1", len(pods))
+	}
+
+	if _, ok := ps.labels["tier"]; ok {
+		t.Errorf("label index still has the removed tier key")
+	}
+	if _, ok := ps.labels["app"]["web"]; ok {
+		t.Errorf("label index still has the replaced app=web value")
+	}
+	if len(ps.containers) != 1 {
+		t.Errorf("container index has %d entries, want 1", len(ps.containers))
+	}
+}
+
+func TestDeleteCleansIndexes(t *testing.T) {
+	ps := New()
+	ps.Upsert(newPod("a", map[string]string{"app": "web"}, "containerd://aaa"))
+	ps.Upsert(newPod("b", map[string]string{"app": "web"}, "containerd://bbb"))
+
+	ps.Delete("a", "default")
+
+	if _, ok := ps.GetByContainerID("aaa"); ok {
+		t.Errorf("deleted container is still indexed")
+	}
+	if pods := ps.GetByLabels(map[string]string{"app": "web"}); len(pods) != 1 || pods[0].GetName() != "b" {
+		t.Errorf("GetByLabels(app=web) after delete = %v, want only b", pods)
+	}
+
+	ps.Delete("b", "default")
+
+	if len(ps.internal) != 0 || len(ps.containers) != 0 || len(ps.labels) != 0 {
+		t.Errorf("store is not empty after deleting every pod: %d pods, %d containers, %d labels",
+			len(ps.internal), len(ps.containers), len(ps.labels))
+	}
+}
+
+func TestDeleteKeepsReusedContainerID(t *testing.T) {
+	ps := New()
+	ps.Upsert(newPod("a", nil, "containerd://shared"))
+	ps.Upsert(newPod("b", nil, "containerd://shared"))
+
+	// The container ID now belongs to b, deleting a must not drop it
+	ps.Delete("a", "default")
+
+	if pod, ok := ps.GetByContainerID("shared"); !ok || pod.GetName() != "b" {
+		t.Errorf("GetByContainerID(shared) after deleting a = %v, %v, want b", pod, ok)
+	}
+}
+
+// populate takes in the number of pods and returns a store holding them,
+// the pods are spread across 10 apps with 3 containers each
+func populate(n int) *PodStore {
+	ps := New()
+	for i := 0; i < n; i++ {
+		ps.Upsert(newPod(
+			fmt.Sprintf("pod-%d", i),
+			map[string]string{"app": fmt.Sprintf("app-%d", i%10), "pod": fmt.Sprintf("pod-%d", i)},
+			fmt.Sprintf("containerd://%d-0", i),
+			fmt.Sprintf("containerd://%d-1", i),
+			fmt.Sprintf("containerd://%d-2", i),
+		))
+	}
+
+	return ps
+}
+
+var sizes = []int{100, 1000, 10000}
+
+func BenchmarkGetByContainerID(b *testing.B) {
+	for _, n := range sizes {
+		b.Run(fmt.Sprintf("pods=%d", n), func(b *testing.B) {
+			ps := populate(n)
+			id := fmt.Sprintf("containerd://%d-2", n-1)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := ps.GetByContainerID(id); !ok {
+					b.Fatalf("container %s not found", id)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetByLabels(b *testing.B) {
+	for _, n := range sizes {
+		b.Run(fmt.Sprintf("pods=%d", n), func(b *testing.B) {
+			ps := populate(n)
+			labels := map[string]string{"app": "app-1", "pod": fmt.Sprintf("pod-%d", n-9)}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if pods := ps.GetByLabels(labels); len(pods) != 1 {
+					b.Fatalf("GetByLabels = %d pods, want 1", len(pods))
+				}
+			}
+		})
+	}
+}
@@ -17,19 +17,59 @@ type K8tricsPod struct {
 // given pod without assuming any protocol
 //
 // The method returns the first endpoint it can find and will return an
-// error if no endpoints are found
+// error if no endpoints are found or if the pod is not yet ready to
+// serve requests
 func (kp K8tricsPod) Endpoint() (string, error) {
+	return kp.NamedEndpoint("")
+}
+
+// NamedEndpoint takes in a container port name and returns the endpoint
+// of the given pod for that port, if the name is empty then the first
+// port of the pod is used
+//
+// The method will return an error if the port is not found or if the pod
+// is not yet ready to serve requests
+func (kp K8tricsPod) NamedEndpoint(portName string) (string, error) {
+	if !kp.Ready() {
+		return "", fmt.Errorf("pod %s/%s is not ready", kp.GetNamespace(), kp.GetName())
+	}
+
 	podip := kp.Status.PodIP
+	if podip == "" {
+		return "", errors.New("failed to retrieve endpoint for the pod: pod has no IP")
+	}
 
 	for _, cont := range kp.Spec.Containers {
 		for _, port := range cont.Ports {
-			return fmt.Sprintf("%s:%d", podip, port.ContainerPort), nil
+			if portName == "" || port.Name == portName {
+				return fmt.Sprintf("%s:%d", podip, port.ContainerPort), nil
+			}
 		}
 	}
 
+	if portName != "" {
+		return "", fmt.Errorf("failed to retrieve endpoint for the pod: port %q not found", portName)
+	}
+
 	return "", errors.New("failed to retrieve endpoint for the pod")
 }
 
+// Ready returns true if the pod is running and all of its containers
+// are reported as ready
+func (kp K8tricsPod) Ready() bool {
+	if kp.Status.Phase != v1.PodRunning {
+		return false
+	}
+
+	for _, cond := range kp.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
 // GetContainerIDs return the SHA256 IDs of all of the containers within
 // the pod
 func (kp K8tricsPod) ContainerIDs() (ids []string) {
@@ -40,6 +80,20 @@ func (kp K8tricsPod) ContainerIDs() (ids []string) {
 	return
 }
 
+// ContainerName takes in a container ID, with or without the container
+// runtime prefix, and returns the name of the container within the pod
+func (kp K8tricsPod) ContainerName(containerID string) (string, bool) {
+	containerID = normaliseContainerID(containerID)
+
+	for _, cs := range kp.Status.ContainerStatuses {
+		if normaliseContainerID(cs.ContainerID) == containerID {
+			return cs.Name, true
+		}
+	}
+
+	return "", false
+}
+
 // GetPod returns a pointer to the internal Pod struct
 func (kp K8tricsPod) GetPod() *v1.Pod {
 	return &kp.Pod
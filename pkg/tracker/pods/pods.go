@@ -1,6 +1,7 @@
 package pods
 
 import (
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
 	"github.com/sagacious-labs/k8trics/pkg/store"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -11,13 +12,18 @@ import (
 // Tracker is a struct representing a Pod tracker
 type Tracker struct {
 	store    *store.PodStore
+	pool     *rpc.Pool
 	informer coreinformer.PodInformer
+
+	// readyHandlers are called whenever a pod becomes ready
+	readyHandlers []func(pod store.K8tricsPod)
 }
 
 // New returns pointer to a Pod Tracker
-func New(informer coreinformer.PodInformer, store *store.PodStore) *Tracker {
+func New(informer coreinformer.PodInformer, store *store.PodStore, pool *rpc.Pool) *Tracker {
 	return &Tracker{
 		store:    store,
+		pool:     pool,
 		informer: informer,
 	}
 }
@@ -26,24 +32,87 @@ func New(informer coreinformer.PodInformer, store *store.PodStore) *Tracker {
 func (t *Tracker) Start() {
 	t.informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    t.handleAdd,
+		UpdateFunc: t.handleUpdate,
 		DeleteFunc: t.handleDelete,
 	})
 }
 
+// OnReady takes in a handler which is called whenever a pod becomes ready
+// to serve requests or moves to a new address while ready, it must be
+// called before Start
+func (t *Tracker) OnReady(handler func(pod store.K8tricsPod)) {
+	t.readyHandlers = append(t.readyHandlers, handler)
+}
+
 func (t *Tracker) handleAdd(obj interface{}) {
 	casted, ok := obj.(*corev1.Pod)
-	println("WHOOOPS")
 	if ok {
-		println("WHOOOPSYYYY")
 		logrus.Debugln("Found pod: ", casted.Name)
 		t.store.Upsert(*casted)
+
+		if pod := (store.K8tricsPod{Pod: *casted}); pod.Ready() {
+			t.notifyReady(pod)
+		}
+	}
+}
+
+func (t *Tracker) handleUpdate(oldObj, newObj interface{}) {
+	casted, ok := newObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	old, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		t.store.Upsert(*casted)
+		return
+	}
+
+	// Periodic resyncs deliver the same object again, nothing to do
+	if old.GetResourceVersion() == casted.GetResourceVersion() {
+		return
+	}
+
+	logrus.Debugln("Update pod: ", casted.Name)
+	t.store.Upsert(*casted)
+
+	pod := store.K8tricsPod{Pod: *casted}
+	moved := casted.Status.PodIP != old.Status.PodIP
+
+	if pod.Ready() && (moved || !(store.K8tricsPod{Pod: *old}).Ready()) {
+		t.notifyReady(pod)
+	}
+
+	// Drop the connections to the old address if the pod has moved or has
+	// stopped serving, new ones will be created on the next request
+	oldIP := old.Status.PodIP
+	if oldIP == "" {
+		return
+	}
+
+	if moved || !pod.Ready() {
+		t.pool.CloseHost(oldIP)
 	}
 }
 
 func (t *Tracker) handleDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
 	casted, ok := obj.(*corev1.Pod)
 	if ok {
 		logrus.Debugln("Delete pod: ", casted.Name)
 		t.store.Delete(casted.GetName(), casted.GetNamespace())
+
+		if ip := casted.Status.PodIP; ip != "" {
+			t.pool.CloseHost(ip)
+		}
+	}
+}
+
+func (t *Tracker) notifyReady(pod store.K8tricsPod) {
+	for _, handler := range t.readyHandlers {
+		handler(pod)
 	}
 }
@@ -1,9 +1,13 @@
 package tracker
 
 import (
+	"sync/atomic"
+
 	"github.com/sagacious-labs/k8trics/pkg/k8s"
+	"github.com/sagacious-labs/k8trics/pkg/rpc"
 	"github.com/sagacious-labs/k8trics/pkg/store"
 	"github.com/sagacious-labs/k8trics/pkg/tracker/pods"
+	"github.com/sirupsen/logrus"
 )
 
 // Tracker
@@ -12,26 +16,54 @@ type Tracker struct {
 	khandler *k8s.K8s
 
 	stop chan struct{}
+	// synced is set to 1 once WaitForSync has seen every informer synced
+	synced int32
 }
 
-func New(khandler *k8s.K8s, store *store.PodStore) *Tracker {
-	pods.New(khandler.Informers().Core().V1().Pods(), store)
-
+func New(khandler *k8s.K8s, store *store.PodStore, pool *rpc.Pool) *Tracker {
 	return &Tracker{
 		khandler: khandler,
-		pod:      pods.New(khandler.Informers().Core().V1().Pods(), store),
+		pod:      pods.New(khandler.Informers().Core().V1().Pods(), store, pool),
 		stop:     make(chan struct{}),
 	}
 }
 
+// OnPodReady takes in a handler which is called whenever a pod becomes
+// ready to serve requests, it must be called before Start
+func (t *Tracker) OnPodReady(handler func(pod store.K8tricsPod)) {
+	t.pod.OnReady(handler)
+}
+
 func (t *Tracker) Start() {
-	println("Attaching helpers")
+	logrus.Debugln("Attaching helpers")
 	t.pod.Start()
 
-	println("Staring the informer")
+	logrus.Debugln("Starting the informer")
 	t.khandler.Informers().Start(t.stop)
 }
 
+// WaitForSync blocks until the caches of all of the informers are synced
+// and returns false if the tracker was stopped before that
+func (t *Tracker) WaitForSync() bool {
+	for typ, synced := range t.khandler.Informers().WaitForCacheSync(t.stop) {
+		if !synced {
+			logrus.Warnf("failed to sync informer cache for %s", typ)
+			return false
+		}
+	}
+
+	atomic.StoreInt32(&t.synced, 1)
+	return true
+}
+
+// Synced returns true if the caches of all of the informers are synced,
+// ie. once WaitForSync has succeeded
+func (t *Tracker) Synced() bool {
+	return atomic.LoadInt32(&t.synced) == 1
+}
+
+// Stop stops the informers started by the tracker, it must be called
+// only once
 func (t *Tracker) Stop() {
-	t.stop <- struct{}{}
+	close(t.stop)
 }
@@ -1,12 +1,11 @@
 package utils
 
 import (
-	"fmt"
 	"os"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
-	v1 "k8s.io/api/core/v1"
 )
 
 // GetEnv takes in the environmental variable key and a fallback
@@ -20,6 +19,42 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
+// GetEnvInt takes in the environmental variable key and a fallback
+// if the env var is absent or is not a valid integer then the fallback
+// is returned or else the parsed integer will be returned
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		logrus.Warnf("invalid integer %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+
+	return i
+}
+
+// GetEnvDuration takes in the environmental variable key and a fallback
+// if the env var is absent or is not a valid duration then the fallback
+// is returned or else the parsed duration will be returned
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Warnf("invalid duration %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+
+	return duration
+}
+
 // SetupLogger reads environmental variable and sets up logrus
 // logger log level
 func SetupLogger() {
@@ -46,16 +81,3 @@ func SetupLogger() {
 
 	logrus.SetLevel(logLevel)
 }
-
-// TrimPodTemplateHash takes in a pod and tries to remove the pod template
-// hash from the pod name. If no pod template hash is found then pod name
-// is returned without any trimming
-func TrimPodTemplateHash(pod *v1.Pod) string {
-	labels := pod.GetLabels()
-	podTemplateHash, ok := labels["pod-template-hash"]
-	if !ok {
-		return pod.GetName()
-	}
-
-	return strings.TrimSuffix(pod.GetName(), fmt.Sprintf("-%s", podTemplateHash))
-}
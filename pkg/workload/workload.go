@@ -0,0 +1,197 @@
+package workload
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// podTemplateHashLabel is set by the Deployment controller on its
+	// ReplicaSets and their pods
+	podTemplateHashLabel = "pod-template-hash"
+	// statefulSetPodNameLabel is set by the StatefulSet controller on its
+	// pods
+	statefulSetPodNameLabel = "statefulset.kubernetes.io/pod-name"
+	// jobNameLabel is set by the Job controller on its pods
+	jobNameLabel = "job-name"
+)
+
+// statefulSetOrdinal matches the ordinal suffix of the StatefulSet pods
+var statefulSetOrdinal = regexp.MustCompile(`-[0-9]+$`)
+
+// Workload is the top-level object which manages a pod, eg. a Deployment,
+// a StatefulSet, a DaemonSet, a Job or a CronJob
+//
+// Pods which are not managed by anything are their own workload
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Resolver maps the pods to their workload by walking up the controller
+// references of the pods, eg. Pod -> ReplicaSet -> Deployment or
+// Pod -> Job -> CronJob
+//
+// When the intermediate owner is not known, eg. before the informers are
+// synced, the workload is derived from the labels set by the controllers
+// on the pods. The owners of the ReplicaSets and the Jobs are cached by
+// their UID until they are deleted
+type Resolver struct {
+	replicaSets appslisters.ReplicaSetLister
+	jobs        batchlisters.JobLister
+
+	cache map[types.UID]Workload
+	lock  sync.RWMutex
+}
+
+// New takes in the shared informer factory and returns a new instance of
+// the resolver
+//
+// The ReplicaSet and Job informers are registered on the factory, hence
+// New must be called before the factory is started
+func New(factory informers.SharedInformerFactory) *Resolver {
+	replicaSets := factory.Apps().V1().ReplicaSets()
+	jobs := factory.Batch().V1().Jobs()
+
+	r := &Resolver{
+		replicaSets: replicaSets.Lister(),
+		jobs:        jobs.Lister(),
+		cache:       make(map[types.UID]Workload),
+	}
+
+	evict := cache.ResourceEventHandlerFuncs{DeleteFunc: r.evict}
+	replicaSets.Informer().AddEventHandler(evict)
+	jobs.Informer().AddEventHandler(evict)
+
+	return r
+}
+
+// Resolve takes in a pod and returns its workload
+func (r *Resolver) Resolve(pod *corev1.Pod) Workload {
+	namespace := pod.GetNamespace()
+
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return fromLabels(pod)
+	}
+
+	switch ref.Kind {
+	case "ReplicaSet":
+		if workload, ok := r.resolveReplicaSet(namespace, ref); ok {
+			return workload
+		}
+
+		// The Deployment names its ReplicaSets after itself and the hash
+		if hash, ok := pod.GetLabels()[podTemplateHashLabel]; ok && strings.HasSuffix(ref.Name, "-"+hash) {
+			return Workload{Kind: "Deployment", Namespace: namespace, Name: strings.TrimSuffix(ref.Name, "-"+hash)}
+		}
+	case "Job":
+		if workload, ok := r.resolveJob(namespace, ref); ok {
+			return workload
+		}
+	}
+
+	return Workload{Kind: ref.Kind, Namespace: namespace, Name: ref.Name}
+}
+
+// resolveReplicaSet takes in the controller reference of a pod and returns
+// the owner of the ReplicaSet, false is returned if the ReplicaSet is not
+// known
+func (r *Resolver) resolveReplicaSet(namespace string, ref *metav1.OwnerReference) (Workload, bool) {
+	if workload, ok := r.cached(ref.UID); ok {
+		return workload, true
+	}
+
+	rs, err := r.replicaSets.ReplicaSets(namespace).Get(ref.Name)
+	if err != nil || rs.GetUID() != ref.UID {
+		return Workload{}, false
+	}
+
+	return r.store(ref.UID, ownerOf(rs, "ReplicaSet")), true
+}
+
+// resolveJob takes in the controller reference of a pod and returns the
+// owner of the Job, false is returned if the Job is not known
+func (r *Resolver) resolveJob(namespace string, ref *metav1.OwnerReference) (Workload, bool) {
+	if workload, ok := r.cached(ref.UID); ok {
+		return workload, true
+	}
+
+	job, err := r.jobs.Jobs(namespace).Get(ref.Name)
+	if err != nil || job.GetUID() != ref.UID {
+		return Workload{}, false
+	}
+
+	return r.store(ref.UID, ownerOf(job, "Job")), true
+}
+
+func (r *Resolver) cached(uid types.UID) (Workload, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	workload, ok := r.cache[uid]
+	return workload, ok
+}
+
+func (r *Resolver) store(uid types.UID, workload Workload) Workload {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cache[uid] = workload
+	return workload
+}
+
+func (r *Resolver) evict(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.cache, object.GetUID())
+}
+
+// ownerOf takes in an intermediate owner of a pod and returns the
+// controller of that owner, the owner itself is returned if it is not
+// controlled by anything
+func ownerOf(obj metav1.Object, kind string) Workload {
+	if ref := metav1.GetControllerOf(obj); ref != nil {
+		return Workload{Kind: ref.Kind, Namespace: obj.GetNamespace(), Name: ref.Name}
+	}
+
+	return Workload{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// fromLabels takes in a pod without a controller reference and derives
+// its workload from the labels set by the controllers, eg. for the pods
+// which were orphaned
+func fromLabels(pod *corev1.Pod) Workload {
+	namespace := pod.GetNamespace()
+	labels := pod.GetLabels()
+
+	if name, ok := labels[statefulSetPodNameLabel]; ok && name == pod.GetName() {
+		return Workload{Kind: "StatefulSet", Namespace: namespace, Name: statefulSetOrdinal.ReplaceAllString(name, "")}
+	}
+
+	if name, ok := labels[jobNameLabel]; ok {
+		return Workload{Kind: "Job", Namespace: namespace, Name: name}
+	}
+
+	return Workload{Kind: "Pod", Namespace: namespace, Name: pod.GetName()}
+}
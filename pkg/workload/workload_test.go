@@ -0,0 +1,182 @@
+package workload
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "default"
+
+// controllerRef takes in the kind, the name and the UID of an object and
+// returns a controller reference to it
+func controllerRef(kind, name string, uid types.UID) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, UID: uid, Controller: &controller}}
+}
+
+// newPod takes in the name of a pod, its labels and its owners and returns
+// the pod
+func newPod(name string, labels map[string]string, owners []metav1.OwnerReference) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       namespace,
+		Labels:          labels,
+		OwnerReferences: owners,
+	}}
+}
+
+// newResolver takes in the objects of the cluster and returns a resolver
+// whose informers are synced with them
+func newResolver(t *testing.T, objects ...runtime.Object) *Resolver {
+	t.Helper()
+
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(objects...), time.Minute)
+	r := New(factory)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	factory.Start(stop)
+	for typ, ok := range factory.WaitForCacheSync(stop) {
+		if !ok {
+			t.Fatalf("informer for %v did not sync", typ)
+		}
+	}
+
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "web-7d9f8b6c5",
+		Namespace:       namespace,
+		UID:             "rs-uid",
+		OwnerReferences: controllerRef("Deployment", "web", "deploy-uid"),
+	}}
+	bareReplicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:      "standalone",
+		Namespace: namespace,
+		UID:       "standalone-uid",
+	}}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:            "backup-27290310",
+		Namespace:       namespace,
+		UID:             "job-uid",
+		OwnerReferences: controllerRef("CronJob", "backup", "cronjob-uid"),
+	}}
+
+	r := newResolver(t, replicaSet, bareReplicaSet, job)
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want Workload
+	}{
+		{
+			name: "deployment through replicaset",
+			pod:  newPod("web-7d9f8b6c5-x2k4p", nil, controllerRef("ReplicaSet", "web-7d9f8b6c5", "rs-uid")),
+			want: Workload{Kind: "Deployment", Namespace: namespace, Name: "web"},
+		},
+		{
+			name: "replicaset without deployment",
+			pod:  newPod("standalone-abcde", nil, controllerRef("ReplicaSet", "standalone", "standalone-uid")),
+			want: Workload{Kind: "ReplicaSet", Namespace: namespace, Name: "standalone"},
+		},
+		{
+			name: "statefulset",
+			pod:  newPod("db-0", nil, controllerRef("StatefulSet", "db", "sts-uid")),
+			want: Workload{Kind: "StatefulSet", Namespace: namespace, Name: "db"},
+		},
+		{
+			name: "daemonset",
+			pod:  newPod("agent-h7xq2", nil, controllerRef("DaemonSet", "agent", "ds-uid")),
+			want: Workload{Kind: "DaemonSet", Namespace: namespace, Name: "agent"},
+		},
+		{
+			name: "cronjob through job",
+			pod:  newPod("backup-27290310-9zv6t", nil, controllerRef("Job", "backup-27290310", "job-uid")),
+			want: Workload{Kind: "CronJob", Namespace: namespace, Name: "backup"},
+		},
+		{
+			name: "bare pod",
+			pod:  newPod("debug", nil, nil),
+			want: Workload{Kind: "Pod", Namespace: namespace, Name: "debug"},
+		},
+		{
+			name: "replicaset not cached falls back to the template hash",
+			pod: newPod("api-5c6d7e8f9-q1w2e",
+				map[string]string{podTemplateHashLabel: "5c6d7e8f9"},
+				controllerRef("ReplicaSet", "api-5c6d7e8f9", "unknown-rs-uid")),
+			want: Workload{Kind: "Deployment", Namespace: namespace, Name: "api"},
+		},
+		{
+			name: "replicaset not cached without the template hash",
+			pod:  newPod("api-5c6d7e8f9-q1w2e", nil, controllerRef("ReplicaSet", "api-5c6d7e8f9", "unknown-rs-uid")),
+			want: Workload{Kind: "ReplicaSet", Namespace: namespace, Name: "api-5c6d7e8f9"},
+		},
+		{
+			name: "replicaset recreated with another uid",
+			pod: newPod("web-7d9f8b6c5-x2k4p",
+				map[string]string{podTemplateHashLabel: "7d9f8b6c5"},
+				controllerRef("ReplicaSet", "web-7d9f8b6c5", "stale-rs-uid")),
+			want: Workload{Kind: "Deployment", Namespace: namespace, Name: "web"},
+		},
+		{
+			name: "job not cached",
+			pod:  newPod("report-1-abcde", nil, controllerRef("Job", "report-1", "unknown-job-uid")),
+			want: Workload{Kind: "Job", Namespace: namespace, Name: "report-1"},
+		},
+		{
+			name: "orphaned statefulset pod",
+			pod:  newPod("db-12", map[string]string{statefulSetPodNameLabel: "db-12"}, nil),
+			want: Workload{Kind: "StatefulSet", Namespace: namespace, Name: "db"},
+		},
+		{
+			name: "orphaned job pod",
+			pod:  newPod("report-1-abcde", map[string]string{jobNameLabel: "report-1"}, nil),
+			want: Workload{Kind: "Job", Namespace: namespace, Name: "report-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Resolve(tt.pod); got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveEvictsDeletedOwners(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "web-7d9f8b6c5",
+		Namespace:       namespace,
+		UID:             "rs-uid",
+		OwnerReferences: controllerRef("Deployment", "web", "deploy-uid"),
+	}}
+
+	r := newResolver(t, replicaSet)
+
+	pod := newPod("web-7d9f8b6c5-x2k4p", nil, controllerRef("ReplicaSet", "web-7d9f8b6c5", "rs-uid"))
+	if got := r.Resolve(pod); got.Kind != "Deployment" {
+		t.Fatalf("Resolve() = %+v, want the Deployment", got)
+	}
+	if _, ok := r.cached("rs-uid"); !ok {
+		t.Fatalf("owner of the ReplicaSet is not cached")
+	}
+
+	r.evict(replicaSet)
+
+	if _, ok := r.cached("rs-uid"); ok {
+		t.Errorf("owner of the deleted ReplicaSet is still cached")
+	}
+}